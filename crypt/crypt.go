@@ -14,12 +14,12 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/apognu/vault/util"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/pbkdf2"
-	"golang.org/x/crypto/ssh/terminal"
 )
 
 func GetCipher(passphrase, nonce []byte) ([]byte, cipher.AEAD) {
@@ -42,52 +42,28 @@ func GetCipher(passphrase, nonce []byte) ([]byte, cipher.AEAD) {
 	return nonce, aesgcm
 }
 
-func GetPassphrase(prompt string, confirm bool) ([]byte, error) {
-	fmt.Printf("%s: ", prompt)
-	passphrase, err := terminal.ReadPassword(0)
-	fmt.Println()
-
-	if strings.TrimSpace(string(passphrase)) == "" {
-		logrus.Fatal("could not use empty passphrase")
-	}
-
-	if confirm {
-		fmt.Print("Confirm: ")
-		confirmation, err := terminal.ReadPassword(0)
-		fmt.Println("")
-		if err != nil {
-			logrus.Fatal("could not read confirmation passphrases")
-		}
-
-		if string(passphrase) != string(confirmation) {
-			logrus.Fatal("passphrases do not match")
-		}
-	}
-
-	return passphrase, err
-}
-
+// GetSecretFile reads the encrypted content of a secret. Secret files that
+// exist but cannot be read or decoded yield an error as well.
 func GetSecretFile(path string) (*util.Secret, error) {
-	filePath := fmt.Sprintf("%s/%s", util.GetVaultPath(), path)
+	filePath := util.GetSecretPath(path)
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return nil, err
 	}
 
 	cipherJson, err := ioutil.ReadFile(filePath)
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	if err != nil {
 		return nil, err
 	}
 
 	var cipherData util.Secret
-	err = json.Unmarshal(cipherJson, &cipherData)
-	if err != nil {
-		logrus.Fatalf("could not unmarshal secret: %s", err)
+	if err := json.Unmarshal(cipherJson, &cipherData); err != nil {
+		return nil, fmt.Errorf("could not unmarshal secret: %s", err)
 	}
 
-	return &cipherData, err
+	return &cipherData, nil
 }
 
-func GetSecret(path string) (*util.Secret, util.AttributeMap) {
+func GetSecret(path string) (*util.SecretMeta, util.AttributeMap) {
 	cipherData, err := GetSecretFile(path)
 	if err != nil {
 		logrus.Fatalf("could not retrieve secret: %s", err)
@@ -101,44 +77,209 @@ func GetSecret(path string) (*util.Secret, util.AttributeMap) {
 	if err != nil {
 		logrus.Fatalf("could not decrypt secret: %s", err)
 	}
+	meta, err := DecryptMeta(cipherData, masterKey)
+	if err != nil {
+		logrus.Fatalf("could not decrypt secret metadata: %s", err)
+	}
 
-	return cipherData, attrs
+	return meta, attrs
 }
 
-func SetSecret(path string, attrs util.AttributeMap, generatorLength int, generatorSymbols, edit bool, editedAttrs []string, rotation bool) {
-	filePath := fmt.Sprintf("%s/%s", util.GetVaultPath(), path)
+// GetSecretMeta decrypts only the metadata of a secret.
+func GetSecretMeta(path string) *util.SecretMeta {
+	cipherData, err := GetSecretFile(path)
+	if err != nil {
+		logrus.Fatalf("could not retrieve secret: %s", err)
+	}
 
-	// For each attribute, set its value
-	for k, v := range attrs {
-		// If eyes-only attribute, prompt for it on the command-line
-		if v.Value == "" {
-			pass, err := GetPassphrase(fmt.Sprintf("Value for '%s'", k), false)
-			if err != nil {
-				logrus.Fatalf("could not read attribute: %s", err)
-			}
-			attrs[k].Value = string(pass)
-			attrs[k].EyesOnly = true
-		} else if v.Value[0] == '@' {
-			filePath := v.Value[1:]
-			content, err := ioutil.ReadFile(filePath)
-			if err != nil {
-				logrus.Fatalf("could not open file %s: %s", filePath, err)
-			}
-			b64 := base64.StdEncoding.EncodeToString(content)
+	meta, err := DecryptMeta(cipherData, GetMasterKey(false, false, false))
+	if err != nil {
+		logrus.Fatalf("could not decrypt secret metadata: %s", err)
+	}
+
+	return meta
+}
+
+// ResolveAttribute computes the value of an attribute given on the command
+// line, prompting for it, generating it or reading it as requested. When a
+// key pair is generated, the attribute holding its public half is returned
+// as well.
+func ResolveAttribute(spec *util.AttributeSpec, generatorLength int, generatorSymbols bool) (*util.Attribute, *util.Attribute, error) {
+	attr := &util.Attribute{
+		Type:     spec.Type,
+		EyesOnly: spec.EyesOnly,
+	}
+	var public *util.Attribute
+
+	switch spec.Source {
+	case util.SourcePrompt:
+		value, err := GetAttributeValue(spec.Name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not read attribute: %s", err)
+		}
+		attr.Value = string(value)
+		attr.EyesOnly = true
+		Wipe(value)
+	case util.SourceGenerate:
+		generator, err := util.GetGenerator(spec.Generator)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		length := spec.Length
+		if length == 0 {
+			length = generator.Length
+		}
+		if length == 0 {
+			length = generatorLength
+		}
+
+		value, publicValue, err := generator.Generate(length, generatorSymbols)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not generate value: %s", err)
+		}
+
+		// Record the policy the value was generated with, to regenerate it
+		attr.Generator = &util.GeneratorParams{
+			Kind:      spec.Generator,
+			Length:    length,
+			Generated: time.Now().Unix(),
+		}
+		if attr.Generator.Kind == "" {
+			attr.Generator.Kind = util.GeneratorPassword
+		}
+		if !generator.Sized {
+			attr.Generator.Length = 0
+		}
+		if attr.Generator.Kind == util.GeneratorPassword {
+			attr.Generator.Symbols = generatorSymbols
+		}
+
+		if attr.Type == "" {
+			attr.Type = generator.Type
+		}
+		setAttributeContent(attr, value)
+		attr.EyesOnly = attr.EyesOnly || generator.Secret
+
+		if publicValue != nil {
+			public = &util.Attribute{Type: generator.PublicType}
+			setAttributeContent(public, publicValue)
+			attr.Generator.Public = spec.Name + util.PublicSuffix
+		}
+	case util.SourceFile:
+		content, err := ioutil.ReadFile(spec.Value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not open file %s: %s", spec.Value, err)
+		}
+		setAttributeContent(attr, content)
+	case util.SourceReference:
+		attr.Reference = spec.Value
+	case util.SourceStdin:
+		content, err := ReadStdin()
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not read STDIN: %s", err)
+		}
+		setAttributeContent(attr, content)
+	default:
+		attr.Value = spec.Value
+	}
+
+	return attr, public, nil
+}
+
+// setAttributeContent stores content read from a file or a stream, encoded
+// if the attribute type holds files, as text otherwise.
+func setAttributeContent(attr *util.Attribute, content []byte) {
+	if util.IsFileType(attr.GetType()) {
+		attr.Value = base64.StdEncoding.EncodeToString(content)
+		attr.File = true
+	} else {
+		attr.Value = strings.TrimSuffix(string(content), "\n")
+	}
+	Wipe(content)
+}
+
+// RegenerateAttribute gives a generated attribute a new value, generated
+// with the policy of the current one, which is archived in its history. The
+// public half of key pairs is regenerated along. It returns the names of the
+// attributes that changed.
+func RegenerateAttribute(attrs util.AttributeMap, name string) ([]string, error) {
+	attr := attrs[name]
+	if attr == nil {
+		return nil, fmt.Errorf("unknown attribute '%s'", name)
+	}
+	if attr.Generator == nil {
+		return nil, fmt.Errorf("attribute '%s' was not generated", name)
+	}
 
-			attrs[k].Value = b64
-			attrs[k].File = true
-		} else if v.Value == "-" {
-			attrs[k].Value = GeneratePassword(generatorLength, generatorSymbols)
-			attrs[k].EyesOnly = true
+	params := attr.Generator
+	spec := &util.AttributeSpec{
+		Name:      name,
+		Type:      attr.Type,
+		Source:    util.SourceGenerate,
+		Generator: params.Kind,
+		Length:    params.Length,
+	}
+
+	next, public, err := ResolveAttribute(spec, params.Length, params.Symbols)
+	if err != nil {
+		return nil, err
+	}
+
+	// Attributes revealed since they were generated stay visible
+	next.EyesOnly = attr.EyesOnly
+	next.Expires = attr.Expires
+
+	historySize := util.ConfigInt("history.size")
+	attr.Replace(next, historySize)
+	attrs[name] = next
+	changed := []string{name}
+
+	if public != nil {
+		if params.Public != "" {
+			next.Generator.Public = params.Public
+		}
+
+		publicName := next.Generator.Public
+		if existing := attrs[publicName]; existing != nil {
+			public.EyesOnly = existing.EyesOnly
+			public.Expires = existing.Expires
+			existing.Replace(public, historySize)
+			attrs[publicName] = public
 		} else {
-			if edit && util.StringArrayContains(editedAttrs, k) {
-				attrs[k].EyesOnly = false
+			attrs.Add(publicName, public)
+		}
+		changed = append(changed, publicName)
+	}
+
+	return changed, nil
+}
+
+func SetSecret(path string, attrs util.AttributeMap, meta *util.SecretMeta, edit bool, editedAttrs []string, rotation bool) {
+	filePath := util.GetSecretPath(path)
+
+	// Rotating the master key does not change the content of the secret
+	if meta == nil {
+		meta = &util.SecretMeta{}
+	}
+
+	// Positions are renumbered so the stored order is always explicit
+	attrs.Reorder(nil)
+
+	// Enforce the behaviour of the attribute type on new values
+	for _, k := range attrs.Keys() {
+		if !edit || util.StringArrayContains(editedAttrs, k) {
+			if err := util.NormalizeAttribute(attrs[k]); err != nil {
+				logrus.Fatalf("invalid attribute '%s': %s", k, err)
 			}
 		}
 	}
 
 	masterKey := GetMasterKey(false, false, rotation)
+	if !rotation {
+		meta.Touch(time.Now(), masterKeySlots[rotation])
+	}
+
 	err := os.MkdirAll(filepath.Dir(filePath), 0700)
 	if err != nil {
 		logrus.Fatalf("could not create hierarchy: %s", err)
@@ -157,6 +298,11 @@ func SetSecret(path string, attrs util.AttributeMap, generatorLength int, genera
 		logrus.Fatalf("could not encrypt secret: %s", err)
 	}
 
+	cipherData.Meta, err = EncryptMeta(meta, masterKey)
+	if err != nil {
+		logrus.Fatalf("could not encrypt secret metadata: %s", err)
+	}
+
 	cipherJson, err := json.Marshal(cipherData)
 	if err != nil {
 		logrus.Fatalf("could not marshal secret: %s", err)
@@ -185,51 +331,116 @@ func GenerateKey(passphrase []byte) []byte {
 }
 
 func EncryptData(attrs util.AttributeMap, passphrase []byte) (*util.Secret, error) {
+	block, err := encryptBlock(attrs, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return &util.Secret{
+		Salt:  block.Salt,
+		Nonce: block.Nonce,
+		Data:  block.Data,
+	}, nil
+}
+
+func DecryptData(secret *util.Secret, passphrase []byte) (util.AttributeMap, error) {
+	var attrs util.AttributeMap
+	block := &util.SecretBlock{Salt: secret.Salt, Nonce: secret.Nonce, Data: secret.Data}
+	if err := decryptBlock(block, passphrase, &attrs); err != nil {
+		return nil, err
+	}
+
+	return attrs, nil
+}
+
+// EncryptMeta encrypts the metadata of a secret, with its own salt and nonce.
+func EncryptMeta(meta *util.SecretMeta, passphrase []byte) (*util.SecretBlock, error) {
+	return encryptBlock(meta, passphrase)
+}
+
+// DecryptMeta decrypts the metadata of a secret. Secrets stored before
+// metadata was recorded get empty metadata.
+func DecryptMeta(secret *util.Secret, passphrase []byte) (*util.SecretMeta, error) {
+	meta := &util.SecretMeta{}
+	if secret.Meta == nil {
+		return meta, nil
+	}
+	if err := decryptBlock(secret.Meta, passphrase, meta); err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+func encryptBlock(v interface{}, passphrase []byte) (*util.SecretBlock, error) {
 	salt := uuid.New().String()
 	key := pbkdf2.Key(passphrase, []byte(salt), util.BpkdfIterations, util.BpkdfKeySize, sha512.New)
+	defer Wipe(key)
 
-	plainData, err := json.Marshal(attrs)
+	plainData, err := json.Marshal(v)
 	if err != nil {
 		return nil, err
 	}
+	defer Wipe(plainData)
 
 	nonce, aesgcm := GetCipher(key, nil)
 	ciphertext := aesgcm.Seal(nil, nonce, plainData, nil)
 
-	return &util.Secret{
+	return &util.SecretBlock{
 		Salt:  fmt.Sprintf("%x", salt),
 		Nonce: fmt.Sprintf("%x", nonce),
 		Data:  fmt.Sprintf("%x", ciphertext),
 	}, nil
 }
 
-func DecryptData(secret *util.Secret, passphrase []byte) (util.AttributeMap, error) {
-	salt, err := hex.DecodeString(secret.Salt)
+func decryptBlock(block *util.SecretBlock, passphrase []byte, v interface{}) error {
+	salt, err := hex.DecodeString(block.Salt)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	nonce, err := hex.DecodeString(secret.Nonce)
+	nonce, err := hex.DecodeString(block.Nonce)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	cipherData, err := hex.DecodeString(secret.Data)
+	cipherData, err := hex.DecodeString(block.Data)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	key := pbkdf2.Key(passphrase, salt, util.BpkdfIterations, util.BpkdfKeySize, sha512.New)
+	defer Wipe(key)
 	_, aesgcm := GetCipher(key, nonce)
 
-	plainJson, err := aesgcm.Open(nil, nonce, cipherData, nil)
-	if err != nil {
-		return nil, err
+	if len(cipherData) < aesgcm.Overhead() {
+		return fmt.Errorf("ciphertext is too short")
 	}
 
-	var attrs util.AttributeMap
-	err = json.Unmarshal(plainJson, &attrs)
+	// Decrypt into locked memory, the plaintext JSON is wiped once parsed
+	plainBuffer := NewSecureBuffer(len(cipherData) - aesgcm.Overhead())
+	defer plainBuffer.Destroy()
+
+	plainJson, err := aesgcm.Open(plainBuffer.Bytes()[:0], nonce, cipherData, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return attrs, nil
+	// Attribute values are decoded into locked memory as well. Strings may
+	// point to it for as long as the process lives, so it is only released
+	// by DestroySecureBuffers.
+	secretValuesLock.Lock()
+	defer secretValuesLock.Unlock()
+
+	var values *SecureBuffer
+	used := 0
+	util.SecretAlloc = func(size int) []byte {
+		if values == nil {
+			values = NewSecureBuffer(len(plainJson))
+		}
+		b := values.Bytes()[used : used+size]
+		used += size
+		return b
+	}
+	defer func() { util.SecretAlloc = nil }()
+
+	return json.Unmarshal(plainJson, v)
 }
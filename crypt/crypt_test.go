@@ -2,7 +2,9 @@ package crypt
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+	"unsafe"
 
 	"github.com/apognu/vault/util"
 	"github.com/stretchr/testify/assert"
@@ -37,6 +39,56 @@ func TestEncryption(t *testing.T) {
 	assert.Equal(t, "strongpassword", decryptedAttrs["password"].Value, "password should be 'strongpassword'")
 }
 
+// secureBufferHolding returns the live secure buffer the content of value
+// lies in, if any.
+func secureBufferHolding(value string) *SecureBuffer {
+	start := uintptr(unsafe.Pointer(unsafe.StringData(value)))
+
+	secureBuffersLock.Lock()
+	defer secureBuffersLock.Unlock()
+
+	for b := range secureBuffers {
+		data := b.Bytes()
+		if len(data) == 0 {
+			continue
+		}
+		first := uintptr(unsafe.Pointer(&data[0]))
+		if start >= first && start+uintptr(len(value)) <= first+uintptr(len(data)) {
+			return b
+		}
+	}
+	return nil
+}
+
+func TestDecryptedValuesInSecureMemory(t *testing.T) {
+	passphrase := []byte("Sup3rS3cre7")
+	attrs := util.AttributeMap{
+		"password": &util.Attribute{Value: "str\"ong\u00e9\n", History: []util.AttributeHistory{{Value: "0ldpassword"}}},
+		"empty":    &util.Attribute{},
+	}
+
+	encryptedSecret, err := EncryptData(attrs, passphrase)
+	assert.Nil(t, err)
+
+	decryptedAttrs, err := DecryptData(encryptedSecret, passphrase)
+	assert.Nil(t, err)
+	assert.Equal(t, attrs["password"].Value, decryptedAttrs["password"].Value)
+	assert.Equal(t, "0ldpassword", decryptedAttrs["password"].History[0].Value)
+	assert.Equal(t, "", decryptedAttrs["empty"].Value)
+
+	buf := secureBufferHolding(decryptedAttrs["password"].Value)
+	assert.NotNil(t, buf, "value should be decoded into a secure buffer")
+	assert.Equal(t, buf, secureBufferHolding(decryptedAttrs["password"].History[0].Value))
+
+	// Wiping the buffer wipes the decoded values
+	buf.Wipe()
+	assert.Equal(t, strings.Repeat("\x00", len("0ldpassword")), decryptedAttrs["password"].History[0].Value)
+	buf.Destroy()
+
+	// Values are only decoded into secure memory while decrypting
+	assert.Nil(t, util.SecretAlloc)
+}
+
 func TestFailingEncryption(t *testing.T) {
 	attrs := util.AttributeMap{
 		"username": &util.Attribute{Value: "apognu"},
@@ -51,3 +103,82 @@ func TestFailingEncryption(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Nil(t, decryptedAttrs)
 }
+
+func TestMetaEncryption(t *testing.T) {
+	passphrase := []byte("Sup3rS3cre7")
+	secret, err := EncryptData(util.AttributeMap{"username": &util.Attribute{Value: "apognu"}}, passphrase)
+	assert.Nil(t, err)
+
+	meta, err := DecryptMeta(secret, passphrase)
+	assert.Nil(t, err)
+	assert.Equal(t, &util.SecretMeta{}, meta, "secrets without metadata should get empty metadata")
+
+	secret.Meta, err = EncryptMeta(&util.SecretMeta{Notes: "Production database", Tags: []string{"prod"}}, passphrase)
+	assert.Nil(t, err)
+	assert.NotContains(t, secret.Meta.Data, "prod")
+
+	meta, err = DecryptMeta(secret, passphrase)
+	assert.Nil(t, err)
+	assert.Equal(t, "Production database", meta.Notes)
+	assert.Equal(t, []string{"prod"}, meta.Tags)
+
+	_, err = DecryptMeta(secret, []byte("WrongPassphrase"))
+	assert.NotNil(t, err)
+}
+
+func TestResolveGeneratedAttribute(t *testing.T) {
+	attr, public, err := ResolveAttribute(&util.AttributeSpec{Name: "token", Source: util.SourceGenerate, Generator: "hex", Length: 8}, 16, false)
+	assert.Nil(t, err)
+	assert.Nil(t, public)
+	assert.Equal(t, 16, len(attr.Value))
+	assert.True(t, attr.EyesOnly)
+
+	attr, _, err = ResolveAttribute(&util.AttributeSpec{Name: "password", Source: util.SourceGenerate}, 24, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 24, len(attr.Value), "passwords should have the configured length")
+
+	attr, public, err = ResolveAttribute(&util.AttributeSpec{Name: "key", Source: util.SourceGenerate, Generator: "ssh-ed25519"}, 16, false)
+	assert.Nil(t, err)
+	assert.Equal(t, util.AttributePEM, attr.Type)
+	assert.True(t, attr.File)
+	assert.True(t, attr.EyesOnly, "the private half should be eyes-only")
+	assert.NotNil(t, public)
+	assert.True(t, public.File)
+	assert.False(t, public.EyesOnly, "the public half should not be eyes-only")
+}
+
+func TestRegenerateAttribute(t *testing.T) {
+	password, _, err := ResolveAttribute(&util.AttributeSpec{Name: "password", Source: util.SourceGenerate}, 24, true)
+	assert.Nil(t, err)
+	assert.Equal(t, &util.GeneratorParams{Kind: util.GeneratorPassword, Length: 24, Symbols: true, Generated: password.Generator.Generated}, password.Generator)
+
+	wg, wgPublic, err := ResolveAttribute(&util.AttributeSpec{Name: "wg", Source: util.SourceGenerate, Generator: "wireguard"}, 16, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "wg_pub", wg.Generator.Public)
+
+	attrs := util.AttributeMap{}
+	attrs.Add("username", &util.Attribute{Value: "apognu"})
+	attrs.Add("password", password)
+	attrs.Add("wg", wg)
+	attrs.Add("wg_pub", wgPublic)
+
+	changed, err := RegenerateAttribute(attrs, "password")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"password"}, changed)
+	assert.NotEqual(t, password.Value, attrs["password"].Value)
+	assert.Equal(t, 24, len(attrs["password"].Value), "the policy should be kept")
+	assert.True(t, attrs["password"].Generator.Symbols)
+	assert.Equal(t, password.Value, attrs["password"].History[0].Value, "the previous value should be recoverable")
+	assert.Equal(t, 2, attrs["password"].Position)
+
+	changed, err = RegenerateAttribute(attrs, "wg")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"wg", "wg_pub"}, changed)
+	assert.NotEqual(t, wgPublic.Value, attrs["wg_pub"].Value)
+	assert.Equal(t, wgPublic.Value, attrs["wg_pub"].History[0].Value)
+
+	_, err = RegenerateAttribute(attrs, "username")
+	assert.NotNil(t, err, "attributes that were not generated cannot be regenerated")
+	_, err = RegenerateAttribute(attrs, "unknown")
+	assert.NotNil(t, err)
+}
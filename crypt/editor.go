@@ -0,0 +1,128 @@
+package crypt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Editor lets the user edit content in $VISUAL or $EDITOR, through private
+// files on a memory-backed filesystem. Files are overwritten and removed after
+// each edit, and their directory when the editor is closed, whichever way the
+// program exits.
+type Editor struct {
+	dir     string
+	signals chan os.Signal
+	once    sync.Once
+}
+
+// NewEditor creates the private directory of an edit session, which may
+// span several edits. Close must be called once it is over.
+func NewEditor() (*Editor, error) {
+	base, err := secureTempDir()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := ioutil.TempDir(base, "vault-")
+	if err != nil {
+		return nil, fmt.Errorf("could not create temporary directory: %s", err)
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	e := &Editor{dir: dir, signals: make(chan os.Signal, 1)}
+
+	// Remove the plaintext whichever way we exit
+	logrus.RegisterExitHandler(e.Close)
+	signal.Notify(e.signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for sig := range e.signals {
+			// Interrupts are meant for the editor, which shares our terminal
+			if sig == os.Interrupt {
+				continue
+			}
+			e.Close()
+			os.Exit(1)
+		}
+	}()
+
+	return e, nil
+}
+
+// Edit opens content in the editor, in a file with the given name, and
+// returns it once the editor exits.
+func (e *Editor) Edit(content []byte, name string) ([]byte, error) {
+	defer wipeFiles(e.dir)
+
+	path := filepath.Join(e.dir, name)
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		return nil, fmt.Errorf("could not write temporary file: %s", err)
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	// The editor may come with arguments, such as 'code --wait'
+	cmd := exec.Command("sh", "-c", fmt.Sprintf(`%s "$1"`, editor), "vault-editor", path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("editor exited with an error: %s", err)
+	}
+
+	edited, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read temporary file: %s", err)
+	}
+
+	return edited, nil
+}
+
+// Close wipes and removes the directory of the edit session. It can safely
+// be called several times.
+func (e *Editor) Close() {
+	e.once.Do(func() {
+		signal.Stop(e.signals)
+		close(e.signals)
+
+		wipeFiles(e.dir)
+		if err := os.RemoveAll(e.dir); err != nil {
+			logrus.Warnf("could not remove temporary directory %s: %s", e.dir, err)
+		}
+	})
+}
+
+// wipeFiles overwrites every regular file of a directory with zeros before
+// removing it.
+func wipeFiles(dir string) {
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+
+		if file, err := os.OpenFile(path, os.O_WRONLY, 0); err == nil {
+			file.Write(make([]byte, info.Size()))
+			file.Sync()
+			file.Close()
+		}
+		os.Remove(path)
+
+		return nil
+	})
+}
@@ -0,0 +1,28 @@
+//go:build linux
+// +build linux
+
+package crypt
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// secureTempDir returns a directory backed by memory, so that plaintext
+// written there never reaches a disk.
+func secureTempDir() (string, error) {
+	for _, dir := range []string{os.Getenv("XDG_RUNTIME_DIR"), "/dev/shm"} {
+		if dir == "" {
+			continue
+		}
+
+		var stat unix.Statfs_t
+		if err := unix.Statfs(dir, &stat); err == nil && stat.Type == unix.TMPFS_MAGIC {
+			return dir, nil
+		}
+	}
+
+	return "", errors.New("no memory-backed directory found, neither $XDG_RUNTIME_DIR nor /dev/shm is a tmpfs")
+}
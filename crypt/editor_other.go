@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package crypt
+
+import "errors"
+
+// secureTempDir fails on platforms where we do not know how to find a
+// directory backed by memory.
+func secureTempDir() (string, error) {
+	return "", errors.New("editing secrets in an editor is only supported on Linux")
+}
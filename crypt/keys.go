@@ -29,8 +29,12 @@ func AddKey(comment string) {
 	if err != nil {
 		logrus.Fatalf("could not read passphrase: %s", err)
 	}
+	passHash := GenerateKey(passphrase)
+	Wipe(passphrase)
 	passSalt := uuid.New().String()
-	passKey := pbkdf2.Key(GenerateKey([]byte(passphrase)), []byte(passSalt), util.BpkdfIterations, util.BpkdfKeySize, sha512.New)
+	passKey := pbkdf2.Key(passHash, []byte(passSalt), util.BpkdfIterations, util.BpkdfKeySize, sha512.New)
+	Wipe(passHash)
+	defer Wipe(passKey)
 
 	nonce, aesgcm := GetCipher(passKey, nil)
 	ciphertext := aesgcm.Seal(nil, nonce, masterKey, nil)
@@ -114,9 +118,11 @@ func RotateKey() {
 	passphrase := GetMasterKey(false, true, false)
 	passSalt := uuid.New().String()
 	passKey := pbkdf2.Key(passphrase, []byte(passSalt), util.BpkdfIterations, util.BpkdfKeySize, sha512.New)
+	defer Wipe(passKey)
 
 	// Generate random master key
 	keyBytes := make([]byte, 4096)
+	defer Wipe(keyBytes)
 	_, err := rand.Read(keyBytes)
 	if err != nil {
 		logrus.Fatalf("could not generate random key: %s", err)
@@ -129,6 +135,7 @@ func RotateKey() {
 	}
 
 	key := pbkdf2.Key(keyBytes, []byte(masterSalt.String()), util.BpkdfIterations, util.BpkdfKeySize, sha512.New)
+	defer Wipe(key)
 	nonce, aesgcm := GetCipher(passKey, nil)
 	ciphertext := aesgcm.Seal(nil, nonce, key, nil)
 
@@ -185,10 +192,19 @@ func rotateSecretKey(path string, info os.FileInfo, err error) error {
 		return nil
 	}
 
-	secretPath := strings.Trim(secretPathTokens[1], "/")
-	_, attrs := GetSecret(secretPath)
+	secretPath, err := util.UnescapePath(strings.Trim(secretPathTokens[1], "/"))
+	if err != nil {
+		return nil
+	}
+
+	// Aliases do not hold any encrypted data
+	if target, _ := util.GetAliasTarget(secretPath); target != "" {
+		return nil
+	}
+
+	meta, attrs := GetSecret(secretPath)
 
-	SetSecret(secretPath, attrs, 0, false, true, []string{}, true)
+	SetSecret(secretPath, attrs, meta, true, []string{}, true)
 
 	return nil
 }
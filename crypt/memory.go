@@ -0,0 +1,107 @@
+package crypt
+
+import (
+	"sync"
+)
+
+// SecureBuffer holds sensitive material (keys, passphrases, plaintext) outside
+// of the Go heap, in memory that is locked into RAM whenever the platform
+// allows it. Its content is zeroed as soon as it is destroyed.
+type SecureBuffer struct {
+	data   []byte
+	mapped bool
+	locked bool
+}
+
+var (
+	secureBuffersLock sync.Mutex
+	secureBuffers     = make(map[*SecureBuffer]struct{})
+
+	// secretValuesLock serializes the decoding of attribute values into
+	// secure buffers, set up through util.SecretAlloc
+	secretValuesLock sync.Mutex
+)
+
+// NewSecureBuffer allocates a zeroed buffer of the given size.
+func NewSecureBuffer(size int) *SecureBuffer {
+	buf := allocSecureBuffer(size)
+
+	secureBuffersLock.Lock()
+	secureBuffers[buf] = struct{}{}
+	secureBuffersLock.Unlock()
+
+	return buf
+}
+
+// NewSecureBufferFrom copies b into a new secure buffer and wipes b.
+func NewSecureBufferFrom(b []byte) *SecureBuffer {
+	buf := NewSecureBuffer(len(b))
+	copy(buf.data, b)
+	Wipe(b)
+
+	return buf
+}
+
+func (b *SecureBuffer) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	return b.data
+}
+
+func (b *SecureBuffer) Len() int {
+	if b == nil {
+		return 0
+	}
+	return len(b.data)
+}
+
+// Wipe zeroes the content of the buffer without releasing it.
+func (b *SecureBuffer) Wipe() {
+	if b == nil {
+		return
+	}
+	Wipe(b.data)
+}
+
+// Destroy zeroes the content of the buffer and releases its memory. The
+// buffer cannot be used afterwards.
+func (b *SecureBuffer) Destroy() {
+	if b == nil || b.data == nil {
+		return
+	}
+
+	Wipe(b.data)
+	freeSecureBuffer(b)
+	b.data = nil
+
+	secureBuffersLock.Lock()
+	delete(secureBuffers, b)
+	secureBuffersLock.Unlock()
+}
+
+// DestroySecureBuffers destroys every secure buffer that is still alive. It
+// is meant to be called right before the process exits.
+func DestroySecureBuffers() {
+	secureBuffersLock.Lock()
+	buffers := make([]*SecureBuffer, 0, len(secureBuffers))
+	for b := range secureBuffers {
+		buffers = append(buffers, b)
+	}
+	secureBuffersLock.Unlock()
+
+	for _, b := range buffers {
+		b.Destroy()
+	}
+
+	passphraseCache = nil
+	masterKeyCache = make(map[bool]*SecureBuffer)
+	masterKeySlots = make(map[bool]string)
+}
+
+// Wipe overwrites a byte slice with zeroes.
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,55 @@
+//go:build linux
+// +build linux
+
+package crypt
+
+import (
+	"github.com/Sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// HardenProcess prevents the process memory from ending up on disk, by
+// disabling core dumps and marking the process as non-dumpable (which also
+// forbids ptrace attachment from unprivileged processes).
+func HardenProcess() {
+	if err := unix.Setrlimit(unix.RLIMIT_CORE, &unix.Rlimit{Cur: 0, Max: 0}); err != nil {
+		logrus.Warnf("could not disable core dumps: %s", err)
+	}
+	if err := unix.Prctl(unix.PR_SET_DUMPABLE, 0, 0, 0, 0); err != nil {
+		logrus.Warnf("could not mark process as non-dumpable: %s", err)
+	}
+}
+
+func allocSecureBuffer(size int) *SecureBuffer {
+	if size == 0 {
+		return &SecureBuffer{data: []byte{}}
+	}
+
+	data, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANON)
+	if err != nil {
+		logrus.Debugf("could not map secure memory, falling back to heap: %s", err)
+		return &SecureBuffer{data: make([]byte, size)}
+	}
+
+	// Never copy this memory into a forked child, and keep it out of core dumps
+	unix.Madvise(data, unix.MADV_DONTFORK)
+	unix.Madvise(data, unix.MADV_DONTDUMP)
+
+	locked := true
+	if err := unix.Mlock(data); err != nil {
+		logrus.Debugf("could not lock secure memory: %s", err)
+		locked = false
+	}
+
+	return &SecureBuffer{data: data, locked: locked, mapped: true}
+}
+
+func freeSecureBuffer(b *SecureBuffer) {
+	if !b.mapped {
+		return
+	}
+	if b.locked {
+		unix.Munlock(b.data)
+	}
+	unix.Munmap(b.data)
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package crypt
+
+// HardenProcess is a no-op on platforms where we do not know how to prevent
+// core dumps.
+func HardenProcess() {}
+
+func allocSecureBuffer(size int) *SecureBuffer {
+	return &SecureBuffer{data: make([]byte, size)}
+}
+
+func freeSecureBuffer(b *SecureBuffer) {}
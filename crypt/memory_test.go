@@ -0,0 +1,134 @@
+package crypt
+
+import (
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/apognu/vault/util"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func isZeroed(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWipe(t *testing.T) {
+	b := []byte("Sup3rS3cre7")
+	Wipe(b)
+
+	assert.Equal(t, 11, len(b), "wiping should not change the length of the slice")
+	assert.True(t, isZeroed(b), "slice should be zeroed")
+}
+
+func TestSecureBufferFrom(t *testing.T) {
+	source := []byte("Sup3rS3cre7")
+	buf := NewSecureBufferFrom(source)
+	defer buf.Destroy()
+
+	assert.Equal(t, "Sup3rS3cre7", string(buf.Bytes()), "buffer should contain the source data")
+	assert.True(t, isZeroed(source), "source slice should be wiped")
+}
+
+func TestSecureBufferWipe(t *testing.T) {
+	buf := NewSecureBufferFrom([]byte("Sup3rS3cre7"))
+	defer buf.Destroy()
+
+	data := buf.Bytes()
+	buf.Wipe()
+
+	assert.Equal(t, 11, buf.Len())
+	assert.True(t, isZeroed(data), "buffer should be zeroed")
+}
+
+func TestSecureBufferDestroy(t *testing.T) {
+	buf := NewSecureBufferFrom([]byte("Sup3rS3cre7"))
+	buf.Destroy()
+
+	assert.Nil(t, buf.Bytes(), "destroyed buffer should not expose any data")
+	assert.Equal(t, 0, buf.Len())
+
+	// Destroying twice should be harmless
+	buf.Destroy()
+}
+
+func TestDestroySecureBuffers(t *testing.T) {
+	first := NewSecureBufferFrom([]byte("first"))
+	second := NewSecureBufferFrom([]byte("second"))
+
+	DestroySecureBuffers()
+
+	assert.Nil(t, first.Bytes())
+	assert.Nil(t, second.Bytes())
+	assert.Nil(t, passphraseCache)
+}
+
+func TestUnlockKeepsCachedPassphrase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-unlock")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	oldPath := os.Getenv("VAULT_PATH")
+	os.Setenv("VAULT_PATH", dir)
+	defer os.Setenv("VAULT_PATH", oldPath)
+
+	// No key slot of the new vault matches the cached passphrase
+	assert.Nil(t, ioutil.WriteFile(dir+"/_vault.meta.new", []byte(`{}`), 0600))
+
+	passphraseCache = NewSecureBufferFrom([]byte("Sup3rS3cre7"))
+	defer DestroySecureBuffers()
+
+	_, err = UnlockMasterKey(false, false, true)
+	assert.NotNil(t, err)
+	assert.Equal(t, "Sup3rS3cre7", string(passphraseCache.Bytes()), "cached passphrase should survive a failed lookup")
+}
+
+// keySlot encrypts a master key with a passphrase, as vault key add does.
+func keySlot(comment string, passphrase, masterKey []byte) util.MasterKey {
+	salt := comment
+	key := pbkdf2.Key(GenerateKey(passphrase), []byte(salt), util.BpkdfIterations, util.BpkdfKeySize, sha512.New)
+	nonce, aesgcm := GetCipher(key, nil)
+
+	return util.MasterKey{
+		Comment: comment,
+		Salt:    fmt.Sprintf("%x", salt),
+		Nonce:   fmt.Sprintf("%x", nonce),
+		Data:    fmt.Sprintf("%x", aesgcm.Seal(nil, nonce, masterKey, nil)),
+	}
+}
+
+func TestUnlockRecordsKeySlot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-unlock")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	oldPath := os.Getenv("VAULT_PATH")
+	os.Setenv("VAULT_PATH", dir)
+	defer os.Setenv("VAULT_PATH", oldPath)
+
+	masterKey := []byte("0123456789abcdef0123456789abcdef")
+	meta := util.VaultMeta{MasterKeys: []util.MasterKey{
+		keySlot("first", []byte("Sup3rS3cre7"), masterKey),
+		keySlot("second", []byte("0th3rS3cre7"), masterKey),
+	}}
+	metaJson, err := json.Marshal(meta)
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(dir+"/_vault.meta", metaJson, 0600))
+
+	passphraseCache = NewSecureBufferFrom(GenerateKey([]byte("0th3rS3cre7")))
+	defer DestroySecureBuffers()
+
+	key, err := UnlockMasterKey(false, false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, masterKey, key)
+	assert.Equal(t, meta.MasterKeys[1].Fingerprint(), masterKeySlots[false], "the slot that unlocked the vault should be recorded")
+}
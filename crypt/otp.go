@@ -0,0 +1,150 @@
+package crypt
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OTPTypeTOTP = "totp"
+	OTPTypeHOTP = "hotp"
+)
+
+// OTP holds the parameters of a one-time password generator, as found in
+// otpauth:// URIs.
+type OTP struct {
+	Type      string
+	Secret    []byte
+	Algorithm string
+	Digits    int
+	Period    int
+	Counter   uint64
+
+	uri *url.URL
+}
+
+// ParseOTP reads either an otpauth:// URI or a raw base32 seed, in which
+// case the usual TOTP defaults are used.
+func ParseOTP(value string) (*OTP, error) {
+	otp := &OTP{
+		Type:      OTPTypeTOTP,
+		Algorithm: "SHA1",
+		Digits:    6,
+		Period:    30,
+	}
+
+	seed := value
+	if strings.HasPrefix(value, "otpauth://") {
+		uri, err := url.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid otpauth URI: %s", err)
+		}
+		otp.uri = uri
+		otp.Type = strings.ToLower(uri.Host)
+		if otp.Type != OTPTypeTOTP && otp.Type != OTPTypeHOTP {
+			return nil, fmt.Errorf("unsupported OTP type '%s'", uri.Host)
+		}
+
+		query := uri.Query()
+		seed = query.Get("secret")
+		if query.Get("algorithm") != "" {
+			otp.Algorithm = strings.ToUpper(query.Get("algorithm"))
+		}
+		if query.Get("digits") != "" {
+			if otp.Digits, err = strconv.Atoi(query.Get("digits")); err != nil || otp.Digits < 6 || otp.Digits > 10 {
+				return nil, errors.New("invalid OTP digits")
+			}
+		}
+		if query.Get("period") != "" {
+			if otp.Period, err = strconv.Atoi(query.Get("period")); err != nil || otp.Period <= 0 {
+				return nil, errors.New("invalid OTP period")
+			}
+		}
+		if otp.Type == OTPTypeHOTP {
+			if otp.Counter, err = strconv.ParseUint(query.Get("counter"), 10, 64); err != nil {
+				return nil, errors.New("HOTP URIs need a valid counter")
+			}
+		}
+	}
+
+	if otp.hash() == nil {
+		return nil, fmt.Errorf("unsupported OTP algorithm '%s'", otp.Algorithm)
+	}
+
+	seed = strings.TrimRight(strings.ToUpper(strings.Replace(seed, " ", "", -1)), "=")
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(seed)
+	if err != nil || len(secret) == 0 {
+		return nil, errors.New("OTP secret is not valid base32")
+	}
+	otp.Secret = secret
+
+	return otp, nil
+}
+
+func (o *OTP) hash() func() hash.Hash {
+	switch o.Algorithm {
+	case "SHA1":
+		return sha1.New
+	case "SHA256":
+		return sha256.New
+	case "SHA512":
+		return sha512.New
+	}
+	return nil
+}
+
+// HOTP computes the code for the given counter, as described in RFC 4226.
+func (o *OTP) HOTP(counter uint64) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, counter)
+
+	mac := hmac.New(o.hash(), o.Secret)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint64(1)
+	for i := 0; i < o.Digits; i++ {
+		modulo *= 10
+	}
+
+	return fmt.Sprintf("%0*d", o.Digits, uint64(code)%modulo)
+}
+
+// TOTP computes the code valid at the given time, as described in RFC 6238,
+// and how long it remains valid.
+func (o *OTP) TOTP(t time.Time) (string, time.Duration) {
+	period := int64(o.Period)
+	step := t.Unix() / period
+	remaining := time.Duration(period-t.Unix()%period) * time.Second
+
+	return o.HOTP(uint64(step)), remaining
+}
+
+// URI serializes the generator back, with its current counter.
+func (o *OTP) URI() string {
+	if o.uri == nil {
+		return ""
+	}
+
+	query := o.uri.Query()
+	if o.Type == OTPTypeHOTP {
+		query.Set("counter", strconv.FormatUint(o.Counter, 10))
+	}
+	o.uri.RawQuery = query.Encode()
+
+	return o.uri.String()
+}
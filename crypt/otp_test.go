@@ -0,0 +1,66 @@
+package crypt
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test vectors from RFC 4226 and RFC 6238
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestHOTP(t *testing.T) {
+	otp, err := ParseOTP("otpauth://hotp/Example:apognu?secret=" + rfcSecret + "&counter=0")
+	assert.Nil(t, err)
+	assert.Equal(t, OTPTypeHOTP, otp.Type)
+
+	expected := []string{"755224", "287082", "359152", "969429", "338314"}
+	for counter, code := range expected {
+		assert.Equal(t, code, otp.HOTP(uint64(counter)))
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	otp, err := ParseOTP("otpauth://totp/Example:apognu?secret=" + rfcSecret + "&digits=8")
+	assert.Nil(t, err)
+
+	code, remaining := otp.TOTP(time.Unix(59, 0))
+	assert.Equal(t, "94287082", code)
+	assert.Equal(t, time.Second, remaining)
+
+	code, _ = otp.TOTP(time.Unix(1111111109, 0))
+	assert.Equal(t, "07081804", code)
+}
+
+func TestTOTPFromSeed(t *testing.T) {
+	otp, err := ParseOTP("gezd gnbv gy3t qojq gezd gnbv gy3t qojq")
+	assert.Nil(t, err, "seeds should be accepted with spaces and lowercase letters")
+	assert.Equal(t, OTPTypeTOTP, otp.Type)
+	assert.Equal(t, 6, otp.Digits)
+
+	code, _ := otp.TOTP(time.Unix(59, 0))
+	assert.Equal(t, "287082", code)
+}
+
+func TestOTPCounterSerialization(t *testing.T) {
+	otp, err := ParseOTP("otpauth://hotp/Example?secret=" + rfcSecret + "&counter=41")
+	assert.Nil(t, err)
+
+	otp.Counter++
+	uri, err := url.Parse(otp.URI())
+	assert.Nil(t, err)
+	assert.Equal(t, "42", uri.Query().Get("counter"))
+	assert.Equal(t, rfcSecret, uri.Query().Get("secret"))
+}
+
+func TestInvalidOTP(t *testing.T) {
+	_, err := ParseOTP("not base32!")
+	assert.NotNil(t, err)
+	_, err = ParseOTP("otpauth://hotp/Example?secret=" + rfcSecret)
+	assert.NotNil(t, err, "HOTP without a counter should be rejected")
+	_, err = ParseOTP("otpauth://totp/Example?secret=" + rfcSecret + "&algorithm=MD5")
+	assert.NotNil(t, err)
+}
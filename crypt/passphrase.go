@@ -0,0 +1,261 @@
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/Sirupsen/logrus"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const PassphraseEnvVar = "VAULT_PASSPHRASE"
+
+var ErrNoTerminal = errors.New("no terminal available to prompt for the passphrase, use --passphrase-fd, --passphrase-file, --passphrase-env, --pinentry-program or --askpass")
+
+// PassphraseSource describes where passphrases are read from instead of the
+// terminal. File descriptors and files provide one passphrase per line, in
+// the order they are requested. A negative FD means no descriptor is used.
+//
+// Pinentry and Askpass name programs used to prompt the user when there is
+// no terminal to do so.
+type PassphraseSource struct {
+	FD       int
+	File     string
+	Env      bool
+	Pinentry string
+	Askpass  string
+}
+
+var (
+	passphraseSource = PassphraseSource{FD: -1}
+	passphraseReader *bufio.Reader
+	envConsumed      bool
+	fdReaders        = make(map[int]*bufio.Reader)
+)
+
+func SetPassphraseSource(source PassphraseSource) error {
+	count := 0
+	if source.FD >= 0 {
+		count++
+	}
+	if source.File != "" {
+		count++
+	}
+	if source.Env {
+		count++
+	}
+	if count > 1 {
+		return errors.New("only one of --passphrase-fd, --passphrase-file and --passphrase-env can be used")
+	}
+
+	passphraseSource = source
+	passphraseReader = nil
+	envConsumed = false
+
+	return nil
+}
+
+func GetPassphrase(prompt string, confirm bool) ([]byte, error) {
+	passphrase, ok, err := readSourcePassphrase()
+	if err != nil {
+		return nil, err
+	}
+
+	// Passphrases from non-interactive sources are never confirmed
+	if !ok {
+		passphrase, ok, err = promptSecret(prompt, confirm)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrNoTerminal
+		}
+	}
+
+	if len(bytes.TrimSpace(passphrase)) == 0 {
+		return nil, errors.New("could not use empty passphrase")
+	}
+
+	return passphrase, nil
+}
+
+// GetAttributeValue reads the value of an eyes-only attribute, from the
+// terminal or the configured prompt program when there is one, or from one
+// line of STDIN otherwise.
+func GetAttributeValue(name string) ([]byte, error) {
+	value, ok, err := promptSecret(fmt.Sprintf("Value for '%s'", name), false)
+	if ok || err != nil {
+		return value, err
+	}
+
+	value, err = readLine(fdReader(0))
+	if err == io.EOF {
+		return nil, fmt.Errorf("no terminal available to prompt for '%s' and nothing left to read on STDIN", name)
+	}
+
+	return value, err
+}
+
+// GetVisibleAttributeValue reads the value of an attribute that does not
+// need to be hidden, echoing it on the terminal if there is one.
+func GetVisibleAttributeValue(name string) ([]byte, error) {
+	if !isTerminal() {
+		return GetAttributeValue(name)
+	}
+
+	fmt.Printf("Value for '%s': ", name)
+	return readLine(fdReader(0))
+}
+
+// PromptLine asks the user a question on the terminal. The boolean is false
+// if there is no terminal to ask on.
+func PromptLine(prompt string) (string, bool, error) {
+	if !isTerminal() {
+		return "", false, nil
+	}
+
+	fmt.Printf("%s: ", prompt)
+	line, err := readLine(fdReader(0))
+	if err != nil {
+		return "", true, err
+	}
+
+	return string(line), true, nil
+}
+
+// promptSecret asks the user for a secret, on the terminal if there is one,
+// or through the configured pinentry or askpass program. The boolean is false
+// if none of them is available.
+func promptSecret(prompt string, confirm bool) ([]byte, bool, error) {
+	var ask func(prompt string) ([]byte, error)
+
+	switch {
+	case isTerminal():
+		ask = promptPassword
+	case passphraseSource.Pinentry != "":
+		ask = func(prompt string) ([]byte, error) {
+			return pinentryPrompt(passphraseSource.Pinentry, prompt)
+		}
+	case passphraseSource.Askpass != "":
+		ask = func(prompt string) ([]byte, error) {
+			return askpassPrompt(passphraseSource.Askpass, prompt)
+		}
+	default:
+		return nil, false, nil
+	}
+
+	secret, err := ask(prompt)
+	if err != nil {
+		return nil, true, err
+	}
+
+	if confirm {
+		confirmation, err := ask("Confirm")
+		if err != nil {
+			Wipe(secret)
+			return nil, true, fmt.Errorf("could not read confirmation passphrase: %s", err)
+		}
+		defer Wipe(confirmation)
+
+		if !bytes.Equal(secret, confirmation) {
+			Wipe(secret)
+			return nil, true, errors.New("passphrases do not match")
+		}
+	}
+
+	return secret, true, nil
+}
+
+// ReadStdin reads everything left on STDIN.
+func ReadStdin() ([]byte, error) {
+	return ioutil.ReadAll(fdReader(0))
+}
+
+func isTerminal() bool {
+	return terminal.IsTerminal(int(os.Stdin.Fd()))
+}
+
+func promptPassword(prompt string) ([]byte, error) {
+	fmt.Printf("%s: ", prompt)
+	passphrase, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+
+	return passphrase, err
+}
+
+// readSourcePassphrase returns the next passphrase from the configured
+// source. The boolean is false if no source was configured.
+func readSourcePassphrase() ([]byte, bool, error) {
+	switch {
+	case passphraseSource.Env:
+		if envConsumed {
+			return nil, false, fmt.Errorf("%s only holds a single passphrase", PassphraseEnvVar)
+		}
+		value, ok := os.LookupEnv(PassphraseEnvVar)
+		if !ok {
+			return nil, false, fmt.Errorf("%s is not set", PassphraseEnvVar)
+		}
+		envConsumed = true
+
+		// Do not leak the passphrase into child processes such as git
+		os.Unsetenv(PassphraseEnvVar)
+
+		return []byte(value), true, nil
+
+	case passphraseSource.File != "":
+		if passphraseReader == nil {
+			file, err := os.Open(passphraseSource.File)
+			if err != nil {
+				return nil, false, fmt.Errorf("could not open passphrase file: %s", err)
+			}
+			if info, err := file.Stat(); err == nil && info.Mode().Perm()&0077 != 0 {
+				logrus.Warnf("passphrase file %s is accessible by other users", passphraseSource.File)
+			}
+			passphraseReader = bufio.NewReader(file)
+		}
+
+		passphrase, err := readLine(passphraseReader)
+		if err == io.EOF {
+			return nil, false, errors.New("no passphrase left in passphrase file")
+		}
+		return passphrase, true, err
+
+	case passphraseSource.FD >= 0:
+		passphrase, err := readLine(fdReader(passphraseSource.FD))
+		if err == io.EOF {
+			return nil, false, fmt.Errorf("no passphrase left on file descriptor %d", passphraseSource.FD)
+		}
+		return passphrase, true, err
+	}
+
+	return nil, false, nil
+}
+
+// fdReader returns a reader shared by every consumer of the descriptor, so
+// buffered lines are not lost between reads.
+func fdReader(fd int) *bufio.Reader {
+	if fdReaders[fd] == nil {
+		fdReaders[fd] = bufio.NewReader(os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd)))
+	}
+	return fdReaders[fd]
+}
+
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		Wipe(line)
+		return nil, err
+	}
+
+	trimmed := bytes.TrimRight(line, "\r\n")
+	value := make([]byte, len(trimmed))
+	copy(value, trimmed)
+	Wipe(line)
+
+	return value, nil
+}
@@ -0,0 +1,70 @@
+package crypt
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPassphraseSourceExclusive(t *testing.T) {
+	err := SetPassphraseSource(PassphraseSource{FD: 3, Env: true})
+	assert.NotNil(t, err, "several passphrase sources should be rejected")
+
+	err = SetPassphraseSource(PassphraseSource{FD: -1})
+	assert.Nil(t, err)
+}
+
+func TestPassphraseFromFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "vault-passphrase")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+
+	file.Chmod(0600)
+	file.WriteString("Sup3rS3cre7\nN3wS3cre7\r\n")
+	file.Close()
+
+	assert.Nil(t, SetPassphraseSource(PassphraseSource{FD: -1, File: file.Name()}))
+	defer SetPassphraseSource(PassphraseSource{FD: -1})
+
+	passphrase, err := GetPassphrase("Enter passphrase", false)
+	assert.Nil(t, err)
+	assert.Equal(t, "Sup3rS3cre7", string(passphrase))
+
+	passphrase, err = GetPassphrase("New passphrase", true)
+	assert.Nil(t, err)
+	assert.Equal(t, "N3wS3cre7", string(passphrase), "line endings should be trimmed")
+
+	_, err = GetPassphrase("Enter passphrase", false)
+	assert.NotNil(t, err, "exhausted passphrase file should yield an error")
+}
+
+func TestPassphraseFromEnv(t *testing.T) {
+	os.Setenv(PassphraseEnvVar, "Sup3rS3cre7")
+	defer os.Unsetenv(PassphraseEnvVar)
+
+	assert.Nil(t, SetPassphraseSource(PassphraseSource{FD: -1, Env: true}))
+	defer SetPassphraseSource(PassphraseSource{FD: -1})
+
+	passphrase, err := GetPassphrase("Enter passphrase", false)
+	assert.Nil(t, err)
+	assert.Equal(t, "Sup3rS3cre7", string(passphrase))
+
+	_, present := os.LookupEnv(PassphraseEnvVar)
+	assert.False(t, present, "passphrase should be removed from the environment")
+
+	_, err = GetPassphrase("Enter passphrase", false)
+	assert.NotNil(t, err, "environment should only provide one passphrase")
+}
+
+func TestEmptyPassphraseFromSource(t *testing.T) {
+	os.Setenv(PassphraseEnvVar, "  ")
+	defer os.Unsetenv(PassphraseEnvVar)
+
+	assert.Nil(t, SetPassphraseSource(PassphraseSource{FD: -1, Env: true}))
+	defer SetPassphraseSource(PassphraseSource{FD: -1})
+
+	_, err := GetPassphrase("Enter passphrase", false)
+	assert.NotNil(t, err, "empty passphrase should be rejected")
+}
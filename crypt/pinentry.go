@@ -0,0 +1,165 @@
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// pinentryPrompt asks for a secret through a program speaking the Assuan
+// pinentry protocol, as GnuPG does.
+func pinentryPrompt(program, prompt string) ([]byte, error) {
+	cmd := exec.Command(program)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("could not run pinentry: %s", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("could not run pinentry: %s", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not run pinentry: %s", err)
+	}
+	defer cmd.Wait()
+	defer stdin.Close()
+
+	reader := bufio.NewReader(stdout)
+
+	// Pinentry greets us before accepting any command
+	if _, err := pinentryResponse(reader, stdin); err != nil {
+		return nil, err
+	}
+
+	commands := []string{
+		"SETTITLE Vault",
+		fmt.Sprintf("SETPROMPT %s:", pinentryEscape(prompt)),
+	}
+	for _, command := range commands {
+		if err := pinentryCommand(reader, stdin, command); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := fmt.Fprintln(stdin, "GETPIN"); err != nil {
+		return nil, fmt.Errorf("could not write to pinentry: %s", err)
+	}
+	pin, err := pinentryResponse(reader, stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintln(stdin, "BYE")
+
+	return pin, nil
+}
+
+func pinentryCommand(r *bufio.Reader, w io.Writer, command string) error {
+	if _, err := fmt.Fprintln(w, command); err != nil {
+		return fmt.Errorf("could not write to pinentry: %s", err)
+	}
+	data, err := pinentryResponse(r, w)
+	Wipe(data)
+
+	return err
+}
+
+// pinentryResponse reads lines until the end of the response to the last
+// command and returns the data lines it contained.
+func pinentryResponse(r *bufio.Reader, w io.Writer) ([]byte, error) {
+	var data []byte
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			Wipe(line)
+			Wipe(data)
+			return nil, fmt.Errorf("could not read from pinentry: %s", err)
+		}
+		content := bytes.TrimRight(line, "\r\n")
+
+		switch {
+		case bytes.Equal(content, []byte("OK")) || bytes.HasPrefix(content, []byte("OK ")):
+			Wipe(line)
+			return data, nil
+		case bytes.HasPrefix(content, []byte("ERR")):
+			err := fmt.Errorf("pinentry failed: %s", strings.TrimSpace(string(content[3:])))
+			Wipe(line)
+			Wipe(data)
+			return nil, err
+		case bytes.HasPrefix(content, []byte("D ")):
+			unescaped, err := pinentryUnescape(content[2:])
+			if err != nil {
+				Wipe(line)
+				Wipe(data)
+				return nil, err
+			}
+			data = append(data, unescaped...)
+			Wipe(unescaped)
+		case bytes.HasPrefix(content, []byte("INQUIRE")):
+			// We never have anything to provide
+			fmt.Fprintln(w, "CAN")
+		}
+
+		// Comments and status lines are ignored
+		Wipe(line)
+	}
+}
+
+func pinentryEscape(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func pinentryUnescape(b []byte) ([]byte, error) {
+	out := make([]byte, 0, len(b))
+
+	for i := 0; i < len(b); i++ {
+		if b[i] != '%' {
+			out = append(out, b[i])
+			continue
+		}
+		if i+2 >= len(b) {
+			Wipe(out)
+			return nil, errors.New("invalid escape sequence in pinentry response")
+		}
+
+		var c [1]byte
+		if _, err := hex.Decode(c[:], b[i+1:i+3]); err != nil {
+			Wipe(out)
+			return nil, errors.New("invalid escape sequence in pinentry response")
+		}
+		out = append(out, c[0])
+		i += 2
+	}
+
+	return out, nil
+}
+
+// askpassPrompt asks for a secret through an askpass program, as OpenSSH
+// does: the prompt is given as the only argument and the secret is read from
+// its standard output.
+func askpassPrompt(program, prompt string) ([]byte, error) {
+	cmd := exec.Command(program, fmt.Sprintf("%s: ", prompt))
+	cmd.Stderr = os.Stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		Wipe(output)
+		return nil, fmt.Errorf("askpass program failed: %s", err)
+	}
+
+	trimmed := bytes.TrimRight(output, "\r\n")
+	secret := make([]byte, len(trimmed))
+	copy(secret, trimmed)
+	Wipe(output)
+
+	return secret, nil
+}
@@ -0,0 +1,109 @@
+package crypt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePinentry speaks just enough of the Assuan protocol for our needs and
+// records the commands it received.
+const fakePinentry = `#!/bin/sh
+echo "OK Pleased to meet you"
+while read -r cmd rest; do
+	echo "$cmd $rest" >> "%[1]s"
+	case "$cmd" in
+		GETPIN) echo "# comment line"; echo "D %[2]s"; echo "OK" ;;
+		BYE) echo "OK closing connection"; exit 0 ;;
+		*) echo "OK" ;;
+	esac
+done
+`
+
+const fakeAskpass = `#!/bin/sh
+echo "$1" > "%[1]s"
+echo "%[2]s"
+`
+
+func writeFakeProgram(t *testing.T, dir, name, script string) string {
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, []byte(script), 0700)
+	assert.Nil(t, err)
+
+	return path
+}
+
+func TestPinentryPrompt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-pinentry")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "commands")
+	program := writeFakeProgram(t, dir, "pinentry", fmt.Sprintf(fakePinentry, logPath, "Sup3r%25S3cre7%0A"))
+
+	pin, err := pinentryPrompt(program, "Enter passphrase")
+	assert.Nil(t, err)
+	assert.Equal(t, "Sup3r%S3cre7\n", string(pin), "pinentry data should be unescaped")
+
+	commands, err := ioutil.ReadFile(logPath)
+	assert.Nil(t, err)
+	assert.Contains(t, string(commands), "SETPROMPT Enter passphrase:", "prompt text should be passed to pinentry")
+	assert.Contains(t, string(commands), "GETPIN")
+}
+
+func TestPinentryCancelled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-pinentry")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	program := writeFakeProgram(t, dir, "pinentry", `#!/bin/sh
+echo "OK Pleased to meet you"
+while read -r cmd rest; do
+	case "$cmd" in
+		GETPIN) echo "ERR 83886179 Operation cancelled" ;;
+		*) echo "OK" ;;
+	esac
+done
+`)
+
+	pin, err := pinentryPrompt(program, "Enter passphrase")
+	assert.NotNil(t, err, "cancelled pinentry should yield an error")
+	assert.Nil(t, pin)
+}
+
+func TestPinentryEscaping(t *testing.T) {
+	assert.Equal(t, "100%25 sure%0Aright", pinentryEscape("100% sure\nright"))
+
+	unescaped, err := pinentryUnescape([]byte("100%25 sure%0aright"))
+	assert.Nil(t, err)
+	assert.Equal(t, "100% sure\nright", string(unescaped))
+
+	_, err = pinentryUnescape([]byte("truncated%2"))
+	assert.NotNil(t, err)
+}
+
+func TestAskpassPrompt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-askpass")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "prompt")
+	program := writeFakeProgram(t, dir, "askpass", fmt.Sprintf(fakeAskpass, logPath, "Sup3rS3cre7"))
+
+	secret, err := askpassPrompt(program, "Enter passphrase")
+	assert.Nil(t, err)
+	assert.Equal(t, "Sup3rS3cre7", string(secret))
+
+	prompt, err := ioutil.ReadFile(logPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "Enter passphrase: \n", string(prompt), "prompt text should be passed to askpass")
+}
+
+func TestAskpassFailure(t *testing.T) {
+	_, err := askpassPrompt("/bin/false", "Enter passphrase")
+	assert.NotNil(t, err)
+}
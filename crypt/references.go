@@ -0,0 +1,166 @@
+package crypt
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/apognu/vault/util"
+)
+
+// ResolveReference follows the reference held by an attribute, through any
+// chain of references, to the attribute holding the value. It returns the
+// path and name of that attribute along with it. The secret the attribute
+// belongs to is read from attrs rather than from the vault, so references
+// can be checked before the secret is written.
+func ResolveReference(path string, attrs util.AttributeMap, name string) (string, string, *util.Attribute, error) {
+	secrets := map[string]util.AttributeMap{path: attrs}
+	chain := make([]string, 0)
+
+	for {
+		ref := fmt.Sprintf("%s#%s", path, name)
+		if util.StringArrayContains(chain, ref) {
+			return "", "", nil, fmt.Errorf("reference cycle %s", strings.Join(append(chain, ref), " → "))
+		}
+		chain = append(chain, ref)
+
+		if secrets[path] == nil {
+			secret, err := readSecret(path)
+			if _, ok := err.(*DecryptionError); ok {
+				return "", "", nil, err
+			}
+			if err != nil {
+				return "", "", nil, fmt.Errorf("dangling reference to %s", ref)
+			}
+			secrets[path] = secret
+		}
+
+		attr := secrets[path][name]
+		if attr == nil {
+			return "", "", nil, fmt.Errorf("dangling reference to %s", ref)
+		}
+		if attr.Reference == "" {
+			return path, name, attr, nil
+		}
+
+		var err error
+		if path, name, err = util.ParseReference(attr.Reference); err != nil {
+			return "", "", nil, err
+		}
+	}
+}
+
+// ResolveReferences replaces the attributes of a secret referencing other
+// secrets with the attributes they point to. Attributes whose reference
+// cannot be resolved are left untouched and reported.
+func ResolveReferences(path string, attrs util.AttributeMap) map[string]error {
+	original := make(util.AttributeMap)
+	for k, v := range attrs {
+		original[k] = v
+	}
+
+	errs := make(map[string]error)
+	for _, k := range original.Keys() {
+		if original[k].Reference == "" {
+			continue
+		}
+
+		_, _, target, err := ResolveReference(path, original, k)
+		if err != nil {
+			errs[k] = err
+			continue
+		}
+
+		attrs[k] = &util.Attribute{
+			Value:        target.Value,
+			EyesOnly:     target.EyesOnly || original[k].EyesOnly,
+			File:         target.File,
+			Type:         target.Type,
+			Position:     original[k].Position,
+			Expires:      target.Expires,
+			ResolvedFrom: original[k].Reference,
+		}
+		if original[k].Expires != "" {
+			attrs[k].Expires = original[k].Expires
+		}
+	}
+
+	return errs
+}
+
+// FindBackReferences lists the attributes of every secret of the vault that
+// directly reference an attribute of the given secret.
+func FindBackReferences(path string) ([]util.BackReference, error) {
+	secrets, err := util.ListSecretPaths("/")
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]util.BackReference, 0)
+	for _, secretPath := range secrets {
+		if target, _ := util.GetAliasTarget(secretPath); target != "" {
+			continue
+		}
+
+		attrs, err := readSecret(secretPath)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, k := range attrs.Keys() {
+			if attrs[k].Reference == "" {
+				continue
+			}
+
+			targetPath, targetName, err := util.ParseReference(attrs[k].Reference)
+			if err != nil || util.ResolveAlias(targetPath) != path {
+				continue
+			}
+
+			refs = append(refs, util.BackReference{Path: secretPath, Attribute: k, Target: targetName})
+		}
+	}
+
+	return refs, nil
+}
+
+// readSecret decrypts a secret, following aliases, returning an error if it
+// does not exist or a DecryptionError if it cannot be decrypted.
+func readSecret(path string) (util.AttributeMap, error) {
+	path = util.ResolveAlias(path)
+
+	info, err := os.Stat(util.GetSecretPath(path))
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("'%s' is a directory", path)
+	}
+
+	// The secret exists, so failing to read it is a decryption failure
+	cipherData, err := GetSecretFile(path)
+	if err != nil {
+		return nil, &DecryptionError{Path: path, Err: err}
+	}
+
+	masterKey, err := UnlockMasterKey(false, false, false)
+	if err != nil {
+		return nil, &DecryptionError{Path: path, Err: err}
+	}
+	attrs, err := DecryptData(cipherData, masterKey)
+	if err != nil {
+		return nil, &DecryptionError{Path: path, Err: err}
+	}
+
+	return attrs, nil
+}
+
+// DecryptionError reports a secret that exists but could not be decrypted.
+type DecryptionError struct {
+	Path string
+	Err  error
+}
+
+func (e *DecryptionError) Error() string {
+	return fmt.Sprintf("could not decrypt secret '%s': %s", e.Path, e.Err)
+}
@@ -0,0 +1,74 @@
+package crypt
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/apognu/vault/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveReference(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-references")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	oldPath := os.Getenv("VAULT_PATH")
+	os.Setenv("VAULT_PATH", dir)
+	defer os.Setenv("VAULT_PATH", oldPath)
+
+	attrs := util.AttributeMap{
+		"password": &util.Attribute{Value: "secret", EyesOnly: true, Position: 1},
+		"alias":    &util.Attribute{Reference: "app#password", Position: 2},
+		"chained":  &util.Attribute{Reference: "app#alias", Position: 3},
+		"loop":     &util.Attribute{Reference: "app#cycle", Position: 4},
+		"cycle":    &util.Attribute{Reference: "app#loop", Position: 5},
+		"missing":  &util.Attribute{Reference: "infra/unknown#password", Position: 6},
+	}
+
+	path, name, attr, err := ResolveReference("app", attrs, "chained")
+	assert.Nil(t, err)
+	assert.Equal(t, "app", path)
+	assert.Equal(t, "password", name)
+	assert.Equal(t, "secret", attr.Value)
+
+	_, _, _, err = ResolveReference("app", attrs, "loop")
+	assert.NotNil(t, err, "cycles should be detected")
+	assert.Contains(t, err.Error(), "cycle")
+
+	_, _, _, err = ResolveReference("app", attrs, "missing")
+	assert.NotNil(t, err, "dangling references should be detected")
+	assert.Contains(t, err.Error(), "dangling")
+
+	errs := ResolveReferences("app", attrs)
+	assert.Equal(t, 3, len(errs))
+	assert.Equal(t, "secret", attrs["alias"].Value)
+	assert.True(t, attrs["alias"].EyesOnly)
+	assert.Equal(t, "app#password", attrs["alias"].ResolvedFrom)
+	assert.Equal(t, 2, attrs["alias"].Position)
+	assert.Equal(t, "app#cycle", attrs["loop"].Reference, "unresolved attributes should be left untouched")
+}
+
+func TestCorruptSecretFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-corrupt")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	oldPath := os.Getenv("VAULT_PATH")
+	os.Setenv("VAULT_PATH", dir)
+	defer os.Setenv("VAULT_PATH", oldPath)
+
+	assert.Nil(t, ioutil.WriteFile(util.GetSecretPath("infra"), []byte(`{"salt":`), 0600))
+
+	_, err = GetSecretFile("infra")
+	assert.NotNil(t, err, "corrupt secret files should yield an error")
+	assert.False(t, os.IsNotExist(err))
+
+	_, err = GetSecretFile("unknown")
+	assert.True(t, os.IsNotExist(err))
+
+	attrs := util.AttributeMap{"password": &util.Attribute{Reference: "infra#password"}}
+	_, _, _, err = ResolveReference("app", attrs, "password")
+	assert.IsType(t, &DecryptionError{}, err, "corrupt referenced secrets should not be reported as missing")
+}
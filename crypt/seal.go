@@ -5,21 +5,24 @@ import (
 	"io/ioutil"
 	"os"
 	"os/user"
+	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/apognu/vault/util"
 )
 
-var (
-	userName = os.Getenv("USER")
-	sealPath = fmt.Sprintf("/tmp/vault-%s.seal", userName)
-)
+var userName = os.Getenv("USER")
 
+// GetSealPath returns the location of the seal of the current vault, keyed
+// by the vault UUID so every vault can be unsealed independently.
 func GetSealPath() string {
+	meta := GetVaultMeta(false)
+	sealPath := fmt.Sprintf("/tmp/vault-%s-%s.seal", userName, meta.UUID)
+
 	currentUser, err := user.Current()
 	if err != nil {
 		return sealPath
 	}
-	meta := GetVaultMeta(false)
 	runDir := fmt.Sprintf("/run/user/%s", currentUser.Uid)
 	if _, err := os.Stat(runDir); os.IsNotExist(err) {
 		return sealPath
@@ -41,6 +44,19 @@ func Unseal() {
 	sealFile.Chmod(0400)
 	sealFile.Write(passphrase)
 
+	// Record when the seal should be considered expired, if ever
+	timeout := util.ConfigDuration("seal.timeout")
+	if timeout > 0 {
+		expiry := time.Now().Add(timeout)
+		err := ioutil.WriteFile(getSealExpiryPath(), []byte(expiry.Format(time.RFC3339)), 0600)
+		if err != nil {
+			logrus.Fatalf("could not record seal expiry: %s", err)
+		}
+
+		logrus.Infof("store is now unsealed until %s", expiry.Format("Mon, 02 Jan 2006, 15:04"))
+		return
+	}
+
 	logrus.Info("store is now unsealed")
 }
 
@@ -52,7 +68,7 @@ func Seal(rotation bool) {
 		return
 	}
 
-	err := os.Remove(GetSealPath())
+	err := removeSeal()
 	if err != nil {
 		logrus.Fatalf("could not seal store: %s", err)
 	}
@@ -64,9 +80,29 @@ func IsUnsealed() bool {
 	if _, err := os.Stat(GetSealPath()); os.IsNotExist(err) {
 		return false
 	}
+
+	// Seal the store again if the unseal timeout expired
+	if expiryText, err := ioutil.ReadFile(getSealExpiryPath()); err == nil {
+		expiry, err := time.Parse(time.RFC3339, string(expiryText))
+		if err != nil || time.Now().After(expiry) {
+			removeSeal()
+			logrus.Info("store unseal timeout expired, store is now sealed")
+			return false
+		}
+	}
+
 	return true
 }
 
+func getSealExpiryPath() string {
+	return fmt.Sprintf("%s.expiry", GetSealPath())
+}
+
+func removeSeal() error {
+	os.Remove(getSealExpiryPath())
+	return os.Remove(GetSealPath())
+}
+
 func GetSeal() ([]byte, error) {
 	key, err := ioutil.ReadFile(GetSealPath())
 	if err != nil {
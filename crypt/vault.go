@@ -4,6 +4,7 @@ import (
 	"crypto/sha512"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
@@ -18,7 +19,13 @@ import (
 	"github.com/Sirupsen/logrus"
 )
 
-var passphraseCache []byte
+var (
+	passphraseCache *SecureBuffer
+	masterKeyCache  = make(map[bool]*SecureBuffer)
+	// masterKeySlots holds the fingerprint of the key slot each cached
+	// master key was unlocked with
+	masterKeySlots = make(map[bool]string)
+)
 
 func createVault() error {
 	if _, err := os.Stat(util.GetVaultPath()); !os.IsNotExist(err) {
@@ -37,11 +44,16 @@ func InitVault() {
 	if err != nil {
 		logrus.Fatalf("could not read passphrase: %s", err)
 	}
+	passHash := GenerateKey(passphrase)
+	Wipe(passphrase)
 	passSalt := uuid.New().String()
-	passKey := pbkdf2.Key(GenerateKey([]byte(passphrase)), []byte(passSalt), util.BpkdfIterations, util.BpkdfKeySize, sha512.New)
+	passKey := pbkdf2.Key(passHash, []byte(passSalt), util.BpkdfIterations, util.BpkdfKeySize, sha512.New)
+	Wipe(passHash)
+	defer Wipe(passKey)
 
 	// Generate random master key
 	keyBytes := make([]byte, 4096)
+	defer Wipe(keyBytes)
 	_, err = rand.Read(keyBytes)
 	if err != nil {
 		logrus.Fatalf("could not generate random key: %s", err)
@@ -54,6 +66,7 @@ func InitVault() {
 	}
 
 	key := pbkdf2.Key(keyBytes, []byte(masterSalt.String()), util.BpkdfIterations, util.BpkdfKeySize, sha512.New)
+	defer Wipe(key)
 	nonce, aesgcm := GetCipher(passKey, nil)
 	ciphertext := aesgcm.Seal(nil, nonce, key, nil)
 
@@ -116,21 +129,40 @@ func GetVaultMeta(rotation bool) util.VaultMeta {
 }
 
 func GetMasterKey(confirm, getPassphrase, rotation bool) []byte {
+	key, err := UnlockMasterKey(confirm, getPassphrase, rotation)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	return key
+}
+
+// UnlockMasterKey works like GetMasterKey, but returns an error instead of
+// exiting when the vault cannot be unlocked.
+func UnlockMasterKey(confirm, getPassphrase, rotation bool) ([]byte, error) {
+	if passphraseCache != nil && masterKeyCache[rotation] != nil {
+		if getPassphrase {
+			return passphraseCache.Bytes(), nil
+		}
+		return masterKeyCache[rotation].Bytes(), nil
+	}
+
 	// Retrieve hashed passphrase either from console or seal
-	var passphrase []byte
-	if len(passphraseCache) == 0 {
+	var passphrase *SecureBuffer
+	if passphraseCache == nil {
 		if !IsUnsealed() {
 			pass, err := GetPassphrase("Enter passphrase", confirm)
 			if err != nil {
-				logrus.Fatalf("could not read passphrase: %s", err)
+				return nil, fmt.Errorf("could not read passphrase: %s", err)
 			}
-			passphrase = GenerateKey(pass)
+			passphrase = NewSecureBufferFrom(GenerateKey(pass))
+			Wipe(pass)
 		} else {
 			seal, err := GetSeal()
 			if err != nil {
-				logrus.Fatalf("could not retrieve passphrase from seal: %s", err)
+				return nil, fmt.Errorf("could not retrieve passphrase from seal: %s", err)
 			}
-			passphrase = seal
+			passphrase = NewSecureBufferFrom(seal)
 		}
 	} else {
 		passphrase = passphraseCache
@@ -142,34 +174,47 @@ func GetMasterKey(confirm, getPassphrase, rotation bool) []byte {
 	for _, mkey := range meta.MasterKeys {
 		salt, err := hex.DecodeString(mkey.Salt)
 		if err != nil {
-			logrus.Fatalf("could not read vault metadata salt: %s", err)
+			return nil, fmt.Errorf("could not read vault metadata salt: %s", err)
 		}
 		nonce, err := hex.DecodeString(mkey.Nonce)
 		if err != nil {
-			logrus.Fatalf("could not read vault metadata nonce: %s", err)
+			return nil, fmt.Errorf("could not read vault metadata nonce: %s", err)
 		}
 		data, err := hex.DecodeString(mkey.Data)
 		if err != nil {
-			logrus.Fatalf("could not read vault metadata data: %s", err)
+			return nil, fmt.Errorf("could not read vault metadata data: %s", err)
 		}
 
-		key := pbkdf2.Key(passphrase, []byte(salt), util.BpkdfIterations, util.BpkdfKeySize, sha512.New)
+		key := pbkdf2.Key(passphrase.Bytes(), []byte(salt), util.BpkdfIterations, util.BpkdfKeySize, sha512.New)
 		nonce, aesgcm := GetCipher(key, nonce)
-		masterKey, err := aesgcm.Open(nil, nonce, data, nil)
+		Wipe(key)
+		if len(data) < aesgcm.Overhead() {
+			continue
+		}
+
+		masterKey := NewSecureBuffer(len(data) - aesgcm.Overhead())
+		_, err = aesgcm.Open(masterKey.Bytes()[:0], nonce, data, nil)
 		if err != nil {
 			// Go to the next key slot
+			masterKey.Destroy()
 			continue
 		}
 
 		passphraseCache = passphrase
+		masterKeyCache[rotation] = masterKey
+		masterKeySlots[rotation] = mkey.Fingerprint()
 
 		if getPassphrase {
-			return passphrase
+			return passphrase.Bytes(), nil
 		} else {
-			return masterKey
+			return masterKey.Bytes(), nil
 		}
 	}
 
-	logrus.Fatalf("could not find matching passphrase")
-	return []byte{}
+	// The cached passphrase is still referenced, and used by later lookups
+	if passphrase != passphraseCache {
+		passphrase.Destroy()
+	}
+
+	return nil, errors.New("could not find matching passphrase")
 }
@@ -15,10 +15,6 @@ import (
 	"github.com/apognu/vault/crypt"
 	"github.com/apognu/vault/util"
 
-	"path/filepath"
-
-	"os"
-
 	"fmt"
 
 	"github.com/gorilla/mux"
@@ -153,22 +149,7 @@ func writeResponse(w http.ResponseWriter, o interface{}) {
 }
 
 func listHandler(w http.ResponseWriter, r *http.Request) {
-	secrets := make([]string, 0)
-	err := filepath.Walk(util.GetVaultPath(), func(path string, info os.FileInfo, err error) error {
-		if walk, err := util.ShouldFileBeWalked(path); !walk {
-			return err
-		}
-
-		secretPathTokens := strings.Split(path, util.GetVaultPath())
-		if len(secretPathTokens) == 0 {
-			return nil
-		}
-
-		secretPath := strings.Trim(secretPathTokens[1], "/")
-		secrets = append(secrets, secretPath)
-
-		return nil
-	})
+	secrets, err := util.ListSecretPaths("/")
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "could not get secrets")
 	}
@@ -177,7 +158,13 @@ func listHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func secretHandler(w http.ResponseWriter, r *http.Request) {
-	secret, err := crypt.GetSecretFile(mux.Vars(r)["name"])
+	name := mux.Vars(r)["name"]
+	if !util.IsValidPath(name) {
+		writeError(w, http.StatusBadRequest, "invalid secret path")
+		return
+	}
+
+	secret, err := crypt.GetSecretFile(name)
 	if err != nil {
 		writeError(w, http.StatusNotFound, "could not open secret file")
 		return
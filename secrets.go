@@ -1,11 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"encoding/base64"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/apognu/vault/crypt"
@@ -13,27 +15,104 @@ import (
 	"github.com/atotto/clipboard"
 )
 
-func listSecrets(path string) {
-	dirPath := fmt.Sprintf("%s/%s", util.GetVaultPath(), path)
+func listSecrets(path string, tags []string, output string) {
+	dirPath := util.GetSecretPath(path)
 	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
 		logrus.Fatal("secret does not exist")
 	}
 
-	util.FormatDirectory(path, 0)
+	tags = splitList(tags)
+	if len(tags) == 0 {
+		entries := util.ListDirectory(path)
+		if output != util.OutputText {
+			printOutput(util.MarshalSecretList(entries, output))
+			return
+		}
+
+		util.FormatDirectory(path, entries)
+		return
+	}
+
+	// Tags are encrypted, so every secret has to be decrypted to be filtered
+	secrets, err := util.ListSecretPaths(path)
+	if err != nil {
+		logrus.Fatalf("could not list secrets: %s", err)
+	}
+
+	matching := make([]string, 0)
+	for _, secret := range secrets {
+		if target, _ := util.GetAliasTarget(secret); target != "" {
+			continue
+		}
+
+		meta := crypt.GetSecretMeta(secret)
+
+		match := true
+		for _, tag := range tags {
+			if !meta.HasTag(tag) {
+				match = false
+				break
+			}
+		}
+		if match {
+			matching = append(matching, secret)
+		}
+	}
+
+	if output != util.OutputText {
+		entries := make([]util.DirectoryEntry, 0, len(matching))
+		for _, secret := range matching {
+			entries = append(entries, util.DirectoryEntry{Path: secret})
+		}
+		printOutput(util.MarshalSecretList(entries, output))
+		return
+	}
+
+	util.FormatSecretPaths(path, matching)
 }
 
-func showSecret(path string, print bool, clip bool, clipAttr string, write bool, writeFiles []string, writeStdout bool) {
-	if !util.IsValidPath(path) {
-		logrus.Fatalf("invalid file path: %s", path)
+// printOutput writes a rendered output format to STDOUT.
+func printOutput(out []byte, err error) {
+	if err != nil {
+		logrus.Fatalf("could not format output: %s", err)
+	}
+
+	os.Stdout.Write(out)
+}
+
+func showSecret(path string, print bool, clip bool, clipAttr string, write bool, writeFiles []string, writeStdout bool, history string, authorizedKeys bool, output string) {
+	if err := util.ValidatePath(path); err != nil {
+		logrus.Fatalf("invalid file path '%s': %s", path, err)
+	}
+
+	// Aliases lead to the secret they point to
+	path = util.ResolveAlias(path)
+
+	meta, attrs := crypt.GetSecret(path)
+
+	if history != "" {
+		if attrs[history] == nil {
+			logrus.Fatalf("could not read attribute '%s'", history)
+		}
+
+		util.FormatAttributeHistory(path, history, attrs[history], print)
+		return
 	}
 
-	_, attrs := crypt.GetSecret(path)
+	// References are resolved when read, so they follow the attribute they
+	// point to
+	unresolved := crypt.ResolveReferences(path, attrs)
 
 	if clipAttr == "" {
-		if attrs.EyesOnlyCount() == 1 {
-			clipAttr = attrs.FindFirstEyesOnly()
-		} else {
-			clipAttr = "password"
+		clipAttr = defaultAttribute(attrs)
+	}
+
+	for _, k := range attrs.Keys() {
+		if err, ok := unresolved[k]; ok {
+			if (clip && k == clipAttr) || (write && (len(writeFiles) == 0 || util.StringArrayContains(writeFiles, k))) || authorizedKeys {
+				logrus.Fatalf("could not read attribute '%s': %s", k, err)
+			}
+			logrus.Warnf("could not resolve attribute '%s': %s", k, err)
 		}
 	}
 
@@ -52,48 +131,384 @@ func showSecret(path string, print bool, clip bool, clipAttr string, write bool,
 		return
 	}
 
-	util.FormatAttributes(path, attrs, print)
+	if authorizedKeys {
+		keys := util.SecretSSHKeys(attrs)
+		if len(keys) == 0 {
+			logrus.Fatal("secret does not hold any SSH key")
+		}
+
+		for _, key := range keys {
+			fmt.Println(key.AuthorizedKey())
+		}
+		return
+	}
+
+	view := util.DescribeSecret(path, meta, attrs, print)
+	if output != util.OutputText {
+		if output == util.OutputEnv || output == util.OutputDotenv {
+			redacted := make([]string, 0)
+			for _, attr := range view.Attributes {
+				if attr.Redacted {
+					redacted = append(redacted, attr.Name)
+				}
+			}
+			if len(redacted) > 0 {
+				logrus.Warnf("redacted attributes %s were left out, use -p to include them", strings.Join(redacted, ", "))
+			}
+		}
+
+		printOutput(util.MarshalSecret(view, output))
+		return
+	}
+
+	util.FormatAttributes(view, print)
+	util.FormatSecretMeta(view)
+
+	// Warn about what expires soon, on STDERR like other messages
+	for _, expiry := range util.SecretExpiries(path, meta, attrs, time.Now(), util.ConfigDuration("expiry.warning")) {
+		what := "secret"
+		if expiry.Attribute != "" {
+			what = fmt.Sprintf("attribute '%s'", expiry.Attribute)
+		}
+
+		switch {
+		case expiry.Days < 0:
+			logrus.Warnf("%s expired on %s", what, expiry.Expires)
+		case expiry.Days == 0:
+			logrus.Warnf("%s expires today", what)
+		default:
+			logrus.Warnf("%s expires on %s, in %d days", what, expiry.Expires, expiry.Days)
+		}
+	}
+}
+
+// Exit codes of 'vault get', so that scripts can tell failures apart.
+const (
+	exitSecretNotFound    = 2
+	exitAttributeNotFound = 3
+	exitDecryptionFailed  = 4
+)
+
+// getAttribute prints the raw value of an attribute, without any decoration,
+// for use in scripts. File attributes are printed decoded.
+func getAttribute(path, name string) {
+	fail := func(code int, format string, args ...interface{}) {
+		logrus.Errorf(format, args...)
+		logrus.Exit(code)
+	}
+
+	if err := util.ValidatePath(path); err != nil {
+		logrus.Fatalf("invalid file path '%s': %s", path, err)
+	}
+
+	// Aliases lead to the secret they point to
+	path = util.ResolveAlias(path)
+
+	if info, err := os.Stat(util.GetSecretPath(path)); err != nil || info.IsDir() {
+		fail(exitSecretNotFound, "secret '%s' does not exist", path)
+	}
+	// The secret exists, so failing to read it is a decryption failure
+	cipherData, err := crypt.GetSecretFile(path)
+	if err != nil {
+		fail(exitDecryptionFailed, "could not read secret '%s': %s", path, err)
+	}
+
+	masterKey, err := crypt.UnlockMasterKey(false, false, false)
+	if err != nil {
+		fail(exitDecryptionFailed, "could not unlock the vault: %s", err)
+	}
+	attrs, err := crypt.DecryptData(cipherData, masterKey)
+	if err != nil {
+		fail(exitDecryptionFailed, "could not decrypt secret: %s", err)
+	}
+
+	if attrs[name] == nil {
+		fail(exitAttributeNotFound, "secret '%s' has no attribute '%s'", path, name)
+	}
+	if err, ok := crypt.ResolveReferences(path, attrs)[name]; ok {
+		if _, decryption := err.(*crypt.DecryptionError); decryption {
+			fail(exitDecryptionFailed, "could not read attribute '%s': %s", name, err)
+		}
+		fail(exitAttributeNotFound, "could not read attribute '%s': %s", name, err)
+	}
+
+	value := []byte(attrs[name].Value)
+	if attrs[name].File {
+		if value, err = base64.StdEncoding.DecodeString(attrs[name].Value); err != nil {
+			fail(exitDecryptionFailed, "could not decode file attribute '%s': %s", name, err)
+		}
+	}
+
+	os.Stdout.Write(value)
+}
+
+func listCertificates(output string) {
+	secrets, err := util.ListSecretPaths("/")
+	if err != nil {
+		logrus.Fatalf("could not list secrets: %s", err)
+	}
+
+	certs := make([]util.Certificate, 0)
+	for _, path := range secrets {
+		if target, _ := util.GetAliasTarget(path); target != "" {
+			continue
+		}
+
+		_, attrs := crypt.GetSecret(path)
+		certs = append(certs, util.SecretCertificates(path, attrs)...)
+	}
+	util.SortCertificates(certs)
+
+	if output == util.OutputJSON {
+		printOutput(util.MarshalJSON(certs))
+		return
+	}
+
+	util.FormatCertificates(certs)
+}
+
+func expiringSecrets(within string, output string) {
+	if within == "" {
+		within = util.ConfigString("expiry.warning")
+	}
+	duration, err := util.ParseDuration(within)
+	if err != nil {
+		logrus.Fatalf("invalid duration: %s", err)
+	}
+
+	secrets, err := util.ListSecretPaths("/")
+	if err != nil {
+		logrus.Fatalf("could not list secrets: %s", err)
+	}
+
+	// Expiration dates are encrypted, so every secret has to be decrypted
+	now := time.Now()
+	expiries := make([]util.Expiry, 0)
+	for _, path := range secrets {
+		if target, _ := util.GetAliasTarget(path); target != "" {
+			continue
+		}
+
+		meta, attrs := crypt.GetSecret(path)
+		expiries = append(expiries, util.SecretExpiries(path, meta, attrs, now, duration)...)
+	}
+	util.SortExpiries(expiries)
+
+	if output == util.OutputJSON {
+		printOutput(util.MarshalJSON(expiries))
+		return
+	}
+
+	util.FormatExpiries(expiries, duration)
+}
+
+func otpSecret(path, attr string, clip bool) {
+	if err := util.ValidatePath(path); err != nil {
+		logrus.Fatalf("invalid file path '%s': %s", path, err)
+	}
+
+	// Aliases lead to the secret they point to
+	path = util.ResolveAlias(path)
+
+	meta, attrs := crypt.GetSecret(path)
+
+	// Without an explicit attribute, use the only OTP attribute of the secret
+	if attr == "" {
+		for k, v := range attrs {
+			if v.GetType() != util.AttributeTOTP {
+				continue
+			}
+			if attr != "" {
+				logrus.Fatal("secret contains several OTP attributes, please specify one")
+			}
+			attr = k
+		}
+		if attr == "" {
+			logrus.Fatal("secret does not contain any OTP attribute")
+		}
+	}
+	if attrs[attr] == nil {
+		logrus.Fatalf("could not read attribute '%s'", attr)
+	}
+
+	// Seeds can be shared through references, the counter of HOTP attributes
+	// being kept in the referenced secret
+	if attrs[attr].Reference != "" {
+		targetPath, targetName, _, err := crypt.ResolveReference(path, attrs, attr)
+		if err != nil {
+			logrus.Fatalf("could not read attribute '%s': %s", attr, err)
+		}
+		path, attr = targetPath, targetName
+		meta, attrs = crypt.GetSecret(path)
+	}
+
+	otp, err := crypt.ParseOTP(attrs[attr].Value)
+	if err != nil {
+		logrus.Fatalf("could not read OTP parameters: %s", err)
+	}
+
+	var code string
+	var validity time.Duration
+	if otp.Type == crypt.OTPTypeHOTP {
+		code = otp.HOTP(otp.Counter)
+
+		// The counter is moved forward so the code is never handed out twice
+		otp.Counter++
+		attrs[attr].Value = otp.URI()
+		crypt.SetSecret(path, attrs, meta, true, []string{attr}, false)
+	} else {
+		code, validity = otp.TOTP(time.Now())
+	}
+
+	if clip {
+		clipboard.WriteAll(code)
+		logrus.Infof("one-time password from '%s' of '%s' was copied to your clipboard", attr, path)
+		return
+	}
+
+	if otp.Type == crypt.OTPTypeHOTP {
+		fmt.Println(code)
+	} else {
+		fmt.Printf("%s (valid for %ds)\n", code, int(validity.Seconds()))
+	}
 }
 
-func addSecret(path string, attributes map[string]string, generatorLength int, generatorSymbols, edit bool, editedAttrs []string) {
-	if !util.IsValidPath(path) {
-		logrus.Fatalf("invalid file path: %s", path)
+func addSecret(path string, attributes []string, template string, tags []string, note string, expires string, attrExpires map[string]string, generatorLength int, generatorSymbols, edit bool, editedAttrs []string) {
+	if err := util.ValidatePath(path); err != nil {
+		logrus.Fatalf("invalid file path '%s': %s", path, err)
 	}
 
 	// Check if the secret already exists in ADD mode
-	filePath := fmt.Sprintf("%s/%s", util.GetVaultPath(), path)
+	filePath := util.GetSecretPath(path)
 	if !edit {
 		if _, err := os.Stat(filePath); !os.IsNotExist(err) {
 			logrus.Fatal("secret already exists")
 		}
 	}
 
+	if len(attributes) == 0 && template == "" {
+		logrus.Fatal("a secret needs at least one attribute or a template")
+	}
+
+	specs, err := util.ParseAttributeSpecs(attributes)
+	if err != nil {
+		logrus.Fatalf("invalid attribute: %s", err)
+	}
+
+	var tmpl *util.Template
+	if template != "" {
+		if tmpl, err = util.GetTemplate(template); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+
+	// Attributes are kept in the order they were given
 	attrs := make(util.AttributeMap)
-	for k, v := range attributes {
-		attrs[k] = &util.Attribute{
-			Value: v,
+	for _, spec := range specs {
+		attr, public := resolveAttribute(spec, tmpl, generatorLength, generatorSymbols)
+		attrs.Add(spec.Name, attr)
+
+		// The public half of key pairs is stored next to the private one
+		if public != nil {
+			attrs.Add(spec.Name+util.PublicSuffix, public)
+		}
+	}
+
+	// Complete the secret with the required attributes of the template, in
+	// the order the template declares them
+	if tmpl != nil {
+		for _, decl := range tmpl.Missing(attrs) {
+			spec := &util.AttributeSpec{Name: decl.Name, Type: decl.Type}
+			switch {
+			case decl.Generate:
+				spec.Source = util.SourceGenerate
+			case util.IsFileType(decl.Type):
+				logrus.Fatalf("attribute '%s' is required by template '%s', give it as %s=@<file>", decl.Name, tmpl.Name, decl.Name)
+			case util.IsSecretType(decl.Type):
+				spec.Source = util.SourcePrompt
+			default:
+				value, err := crypt.GetVisibleAttributeValue(decl.Name)
+				if err != nil {
+					logrus.Fatalf("could not read attribute: %s", err)
+				}
+				spec.Value = string(value)
+			}
+
+			attr, _ := resolveAttribute(spec, tmpl, generatorLength, generatorSymbols)
+			attrs.Add(decl.Name, attr)
+		}
+
+		attrs.Reorder(tmpl.Names())
+
+		if err := tmpl.Validate(attrs); err != nil {
+			logrus.Fatalf("secret does not match template: %s", err)
 		}
 	}
 
-	crypt.SetSecret(path, attrs, generatorLength, generatorSymbols, edit, editedAttrs, false)
+	checkReferences(path, attrs, attrs.Keys())
+
+	meta := &util.SecretMeta{Notes: note}
+	if tmpl != nil {
+		meta.Template = tmpl.Name
+	}
+	setExpiries(meta, attrs, &expires, attrExpires)
+	if err := meta.AddTags(splitList(tags)); err != nil {
+		logrus.Fatal(err)
+	}
+
+	crypt.SetSecret(path, attrs, meta, edit, editedAttrs, false)
 }
 
-func editSecret(path string, newAttrs map[string]string, deletedAttrs []string, generatorLength int, generatorSymbols bool) {
-	if !util.IsValidPath(path) {
-		logrus.Fatalf("invalid file path: %s", path)
+func editSecret(path string, newAttrs []string, deletedAttrs []string, order []string, renamedAttrs map[string]string, hiddenAttrs, revealedAttrs, revertedAttrs []string, tags, untags []string, note *string, expires *string, attrExpires map[string]string, generatorLength int, generatorSymbols bool) {
+	if err := util.ValidatePath(path); err != nil {
+		logrus.Fatalf("invalid file path '%s': %s", path, err)
 	}
 
-	_, attrs := crypt.GetSecret(path)
+	// Aliases lead to the secret they point to
+	path = util.ResolveAlias(path)
+
+	specs, err := util.ParseAttributeSpecs(newAttrs)
+	if err != nil {
+		logrus.Fatalf("invalid attribute: %s", err)
+	}
+
+	meta, attrs := crypt.GetSecret(path)
 	editedAttrs := make([]string, 0)
 
-	// Replace old attributes with new ones
-	for k, v := range newAttrs {
-		if attrs[k] == nil {
-			attrs[k] = &util.Attribute{Value: v}
+	// Secrets created from a template that was since removed are not checked
+	var tmpl *util.Template
+	if meta.Template != "" {
+		if tmpl, err = util.GetTemplate(meta.Template); err != nil {
+			logrus.Warnf("secret will not be validated: %s", err)
+		}
+	}
+
+	// Replace old attributes with new ones, new attributes go last
+	set := func(name string, attr *util.Attribute) {
+		if existing := attrs[name]; existing != nil {
+			if existing.Pending != nil {
+				logrus.Warnf("pending value of attribute '%s' was discarded", name)
+			}
+			// Existing attributes keep their place, their previous values and
+			// their type unless a new one is given
+			existing.Replace(attr, util.ConfigInt("history.size"))
+			if attr.Type == "" {
+				attr.Type = existing.Type
+			}
+			attrs[name] = attr
 		} else {
-			attrs[k].Value = v
+			attrs.Add(name, attr)
+		}
+		editedAttrs = append(editedAttrs, name)
+	}
+	for _, spec := range specs {
+		attr, public := resolveAttribute(spec, tmpl, generatorLength, generatorSymbols)
+		set(spec.Name, attr)
+
+		// The public half of key pairs is stored next to the private one
+		if public != nil {
+			set(spec.Name+util.PublicSuffix, public)
 		}
-		editedAttrs = append(editedAttrs, k)
 	}
 
 	// Remove deleted attributes from the map
@@ -101,22 +516,665 @@ func editSecret(path string, newAttrs map[string]string, deletedAttrs []string,
 		delete(attrs, k)
 	}
 
-	crypt.SetSecret(path, attrs, generatorLength, generatorSymbols, true, editedAttrs, false)
+	// Rename attributes, keeping their value, flags and place
+	renamed := make(util.AttributeMap)
+	renamedFrom := make(map[string]string)
+	for oldName, newName := range renamedAttrs {
+		if attrs[oldName] == nil {
+			logrus.Fatalf("cannot rename unknown attribute '%s'", oldName)
+		}
+		if newName == "" || strings.Contains(newName, ":") {
+			logrus.Fatalf("invalid attribute name '%s'", newName)
+		}
+		if other, ok := renamedFrom[newName]; ok {
+			logrus.Fatalf("cannot rename both '%s' and '%s' to '%s'", other, oldName, newName)
+		}
+		renamedFrom[newName] = oldName
+		renamed[newName] = attrs[oldName]
+		delete(attrs, oldName)
+
+		// New values are still validated under their new name
+		for i, k := range editedAttrs {
+			if k == oldName {
+				editedAttrs[i] = newName
+			}
+		}
+	}
+	for newName, attr := range renamed {
+		if attrs[newName] != nil {
+			logrus.Fatalf("cannot rename to '%s', attribute already exists", newName)
+		}
+		attrs[newName] = attr
+	}
+	for _, attr := range attrs {
+		// Key pairs follow their public half
+		if attr.Generator != nil && renamedAttrs[attr.Generator.Public] != "" {
+			attr.Generator.Public = renamedAttrs[attr.Generator.Public]
+		}
+	}
+
+	// Restore previous values, given as attr or attr@N
+	for _, ref := range revertedAttrs {
+		k, n, err := util.ParseHistoryRef(ref)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if attrs[k] == nil {
+			logrus.Fatalf("cannot revert unknown attribute '%s'", k)
+		}
+		if err := attrs[k].Revert(n, util.ConfigInt("history.size")); err != nil {
+			logrus.Fatalf("cannot revert attribute '%s': %s", k, err)
+		}
+	}
+
+	// Toggle eyes-only flags without touching values
+	for _, k := range hiddenAttrs {
+		if attrs[k] == nil {
+			logrus.Fatalf("cannot hide unknown attribute '%s'", k)
+		}
+		attrs[k].EyesOnly = true
+	}
+	for _, k := range revealedAttrs {
+		if attrs[k] == nil {
+			logrus.Fatalf("cannot reveal unknown attribute '%s'", k)
+		}
+		if util.IsSecretType(attrs[k].Type) {
+			logrus.Fatalf("attribute '%s' is of type %s, which is always eyes-only", k, attrs[k].Type)
+		}
+		attrs[k].EyesOnly = false
+	}
+
+	// Move the requested attributes first
+	if len(order) > 0 {
+		first := make([]string, 0)
+		for _, k := range splitList(order) {
+			if attrs[k] == nil {
+				logrus.Fatalf("cannot reorder unknown attribute '%s'", k)
+			}
+			first = append(first, k)
+		}
+		attrs.Reorder(first)
+	}
+
+	meta.RemoveTags(splitList(untags))
+	if err := meta.AddTags(splitList(tags)); err != nil {
+		logrus.Fatal(err)
+	}
+	if note != nil {
+		meta.Notes = *note
+	}
+	setExpiries(meta, attrs, expires, attrExpires)
+
+	if tmpl != nil {
+		if err := tmpl.Validate(attrs); err != nil {
+			logrus.Fatalf("secret does not match template '%s': %s", tmpl.Name, err)
+		}
+	}
+
+	checkReferences(path, attrs, editedAttrs)
+
+	crypt.SetSecret(path, attrs, meta, true, editedAttrs, false)
+}
+
+// editSecretInEditor opens the secret as a YAML document in the user's
+// editor, and saves it once the document is valid. Invalid documents can be
+// edited again until they are fixed or abandoned.
+func editSecretInEditor(path string) {
+	if err := util.ValidatePath(path); err != nil {
+		logrus.Fatalf("invalid file path '%s': %s", path, err)
+	}
+
+	// Aliases lead to the secret they point to
+	path = util.ResolveAlias(path)
+
+	meta, attrs := crypt.GetSecret(path)
+
+	original, err := util.MarshalSecretDocument(path, meta, attrs)
+	if err != nil {
+		logrus.Fatalf("could not write secret document: %s", err)
+	}
+	defer crypt.Wipe(original)
+
+	editor, err := crypt.NewEditor()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	defer editor.Close()
+
+	// Edited documents are wiped once they are not needed anymore, the
+	// original one when we return
+	document := original
+	wipe := func() {
+		if len(document) > 0 && &document[0] != &original[0] {
+			crypt.Wipe(document)
+		}
+	}
+
+	for {
+		edited, err := editor.Edit(document, "secret.yaml")
+		wipe()
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		document = edited
+
+		if bytes.Equal(document, original) {
+			wipe()
+			logrus.Info("secret was not changed")
+			return
+		}
+
+		nextMeta, nextAttrs, editedAttrs, err := applySecretDocument(path, meta, attrs, document)
+		if err == nil {
+			wipe()
+			crypt.SetSecret(path, nextAttrs, nextMeta, true, editedAttrs, false)
+			return
+		}
+
+		logrus.Errorf("invalid secret: %s", err)
+		answer, ok, _ := crypt.PromptLine("Edit the secret again? [Y/n]")
+		if !ok || strings.HasPrefix(strings.ToLower(answer), "n") {
+			wipe()
+			logrus.Fatal("secret was not changed")
+		}
+	}
+}
+
+// applySecretDocument reads an edited secret document, returning the secret
+// it describes if it is valid.
+func applySecretDocument(path string, meta *util.SecretMeta, attrs util.AttributeMap, document []byte) (*util.SecretMeta, util.AttributeMap, []string, error) {
+	doc, err := util.ParseSecretDocument(document)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Work on copies, so that the document can be edited again on error
+	current := make(util.AttributeMap)
+	for k, attr := range attrs {
+		copied := *attr
+		current[k] = &copied
+	}
+
+	nextMeta, nextAttrs, editedAttrs, err := doc.Apply(meta, current, time.Now(), util.ConfigInt("history.size"))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	for _, k := range editedAttrs {
+		if err := util.NormalizeAttribute(nextAttrs[k]); err != nil {
+			return nil, nil, nil, fmt.Errorf("attribute '%s': %s", k, err)
+		}
+		if nextAttrs[k].Reference != "" {
+			if _, _, _, err := crypt.ResolveReference(path, nextAttrs, k); err != nil {
+				return nil, nil, nil, fmt.Errorf("attribute '%s': %s", k, err)
+			}
+		}
+		if attrs[k] != nil && attrs[k].Pending != nil && nextAttrs[k].Pending == nil {
+			logrus.Warnf("pending value of attribute '%s' was discarded", k)
+		}
+	}
+
+	if meta.Template != "" {
+		tmpl, err := util.GetTemplate(meta.Template)
+		if err != nil {
+			logrus.Warnf("secret will not be validated: %s", err)
+		} else if err := tmpl.Validate(nextAttrs); err != nil {
+			return nil, nil, nil, fmt.Errorf("secret does not match template '%s': %s", tmpl.Name, err)
+		}
+	}
+
+	return nextMeta, nextAttrs, editedAttrs, nil
+}
+
+// resolveAttribute computes the value of an attribute given on the command
+// line. The template declaring the attribute, if any, provides its type and
+// generation policy.
+func resolveAttribute(spec *util.AttributeSpec, tmpl *util.Template, generatorLength int, generatorSymbols bool) (*util.Attribute, *util.Attribute) {
+	if tmpl != nil {
+		if decl := tmpl.Attribute(spec.Name); decl != nil {
+			// Files are stored with the more specific type of the template
+			if spec.Type == "" || (spec.Type == util.AttributeFile && util.IsFileType(decl.Type)) {
+				spec.Type = decl.Type
+			}
+			if decl.Length > 0 {
+				generatorLength = decl.Length
+			}
+			if decl.Symbols {
+				generatorSymbols = true
+			}
+		}
+	}
+
+	attr, public, err := crypt.ResolveAttribute(spec, generatorLength, generatorSymbols)
+	if err != nil {
+		logrus.Fatalf("invalid attribute '%s': %s", spec.Name, err)
+	}
+
+	return attr, public
+}
+
+// setExpiries sets the expiration dates of a secret, if expires is not nil,
+// and of its attributes. Empty dates remove the expiration date.
+func setExpiries(meta *util.SecretMeta, attrs util.AttributeMap, expires *string, attrExpires map[string]string) {
+	parse := func(value string) string {
+		if value == "" {
+			return ""
+		}
+		date, err := util.ParseExpiry(value, time.Now())
+		if err != nil {
+			logrus.Fatalf("invalid expiration date: %s", err)
+		}
+		return date
+	}
+
+	if expires != nil {
+		meta.Expires = parse(*expires)
+	}
+	for k, value := range attrExpires {
+		if attrs[k] == nil {
+			logrus.Fatalf("cannot set the expiration date of unknown attribute '%s'", k)
+		}
+		attrs[k].Expires = parse(value)
+	}
+}
+
+// checkReferences makes sure new references point to an existing attribute
+// without creating a cycle.
+func checkReferences(path string, attrs util.AttributeMap, names []string) {
+	for _, k := range names {
+		if attrs[k] == nil || attrs[k].Reference == "" {
+			continue
+		}
+		if _, _, _, err := crypt.ResolveReference(path, attrs, k); err != nil {
+			logrus.Fatalf("invalid attribute '%s': %s", k, err)
+		}
+	}
+}
+
+func listBackReferences(path string) {
+	if err := util.ValidatePath(path); err != nil {
+		logrus.Fatalf("invalid file path '%s': %s", path, err)
+	}
+
+	// Aliases lead to the secret they point to
+	path = util.ResolveAlias(path)
+	if _, err := crypt.GetSecretFile(path); err != nil {
+		logrus.Fatal("secret does not exist")
+	}
+
+	refs, err := crypt.FindBackReferences(path)
+	if err != nil {
+		logrus.Fatalf("could not list references: %s", err)
+	}
+
+	util.FormatBackReferences(path, refs)
+}
+
+func listTemplates() {
+	templates, err := util.LoadTemplates()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	util.FormatTemplates(templates)
+}
+
+// generateSSHKey stores a new SSH key pair in the privkey and pubkey
+// attributes of a secret, creating the secret if needed, and prints the
+// public key. The private key is never written outside of the vault.
+func generateSSHKey(path, keyType string, bits int, comment string) {
+	if err := util.ValidatePath(path); err != nil {
+		logrus.Fatalf("invalid file path '%s': %s", path, err)
+	}
+
+	// Aliases lead to the secret they point to
+	path = util.ResolveAlias(path)
+
+	meta := &util.SecretMeta{}
+	attrs := make(util.AttributeMap)
+	edit := false
+	if _, err := os.Stat(util.GetSecretPath(path)); err == nil {
+		meta, attrs = crypt.GetSecret(path)
+		edit = true
+	}
+
+	for _, name := range []string{"privkey", "pubkey"} {
+		if attrs[name] != nil {
+			logrus.Fatalf("attribute '%s' already exists", name)
+		}
+	}
+
+	private, public, err := util.GenerateSSHKey(keyType, bits, comment)
+	if err != nil {
+		logrus.Fatalf("could not generate SSH key: %s", err)
+	}
+
+	attrs.Add("privkey", &util.Attribute{Value: base64.StdEncoding.EncodeToString(private), File: true, Type: util.AttributePEM, EyesOnly: true})
+	attrs.Add("pubkey", &util.Attribute{Value: base64.StdEncoding.EncodeToString(public), File: true, Type: util.AttributeFile})
+
+	crypt.SetSecret(path, attrs, meta, edit, []string{"privkey", "pubkey"}, false)
+
+	fmt.Print(string(public))
+}
+
+// printGenerated prints a value of the given kind, followed by its public
+// half for key pairs, without storing it. Without a kind, the available
+// generators are listed.
+func printGenerated(kind string, length int, symbols bool) {
+	if kind == "" {
+		util.FormatGenerators()
+		return
+	}
+
+	generator, err := util.GetGenerator(kind)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	if length != 0 && !generator.Sized {
+		logrus.Fatalf("generator '%s' does not take a length", kind)
+	}
+
+	if length == 0 {
+		length = generator.Length
+	}
+	if length == 0 {
+		length = util.ConfigInt("generator.length")
+	}
+
+	value, public, err := generator.Generate(length, symbols)
+	if err != nil {
+		logrus.Fatalf("could not generate value: %s", err)
+	}
+
+	fmt.Println(strings.TrimSuffix(string(value), "\n"))
+	if public != nil {
+		fmt.Println(strings.TrimSuffix(string(public), "\n"))
+	}
+}
+
+// regenerateSecret gives new values to generated attributes of a secret,
+// all of them if none is given, with the policy they were generated with.
+func regenerateSecret(path string, names []string, dryRun bool) {
+	if err := util.ValidatePath(path); err != nil {
+		logrus.Fatalf("invalid file path '%s': %s", path, err)
+	}
+
+	// Aliases lead to the secret they point to
+	path = util.ResolveAlias(path)
+
+	meta, attrs := crypt.GetSecret(path)
+
+	if len(names) == 0 {
+		for _, k := range attrs.Keys() {
+			if attrs[k].Generator != nil {
+				names = append(names, k)
+			}
+		}
+		if len(names) == 0 {
+			logrus.Fatalf("secret '%s' does not have any generated attribute", path)
+		}
+	}
+
+	regenerateAttributes(path, meta, attrs, names, dryRun)
+}
+
+// regenerateOlderThan gives new values to the generated attributes of every
+// secret below a directory that were generated longer ago than the given
+// duration.
+func regenerateOlderThan(dir string, olderThan string, dryRun bool) {
+	age, err := util.ParseDuration(olderThan)
+	if err != nil {
+		logrus.Fatalf("invalid duration '%s': %s", olderThan, err)
+	}
+	before := time.Now().Add(-age)
+
+	if dir == "" {
+		dir = "/"
+	}
+	secrets, err := util.ListSecretPaths(dir)
+	if err != nil {
+		logrus.Fatalf("could not list secrets: %s", err)
+	}
+
+	count := 0
+	for _, path := range secrets {
+		if target, _ := util.GetAliasTarget(path); target != "" {
+			continue
+		}
+
+		meta, attrs := crypt.GetSecret(path)
+
+		names := make([]string, 0)
+		for _, k := range attrs.Keys() {
+			if attrs[k].GeneratedBefore(before) {
+				names = append(names, k)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+
+		regenerateAttributes(path, meta, attrs, names, dryRun)
+		count += len(names)
+	}
+
+	if count == 0 {
+		logrus.Infof("no attribute was generated more than %s ago", olderThan)
+	}
+}
+
+func regenerateAttributes(path string, meta *util.SecretMeta, attrs util.AttributeMap, names []string, dryRun bool) {
+	if dryRun {
+		for _, k := range names {
+			if attrs[k] == nil || attrs[k].Generator == nil {
+				logrus.Fatalf("attribute '%s' of '%s' was not generated", k, path)
+			}
+			generated := time.Unix(attrs[k].Generator.Generated, 0).Format("Mon, 02 Jan 2006, 15:04")
+			fmt.Printf("%s#%s (%s, generated on %s)\n", path, k, attrs[k].Generator.Kind, generated)
+		}
+		return
+	}
+
+	editedAttrs := make([]string, 0)
+	for _, k := range names {
+		changed, err := crypt.RegenerateAttribute(attrs, k)
+		if err != nil {
+			logrus.Fatalf("could not regenerate attribute of '%s': %s", path, err)
+		}
+		editedAttrs = append(editedAttrs, changed...)
+	}
+
+	crypt.SetSecret(path, attrs, meta, true, editedAttrs, false)
+}
+
+// changeSecret stages a new value for an attribute of a secret, generated or
+// typed, and copies it to the clipboard. The current value stays in place
+// until the change is confirmed, so it can be restored if the new value is
+// rejected.
+func changeSecret(path, name, generator string, prompt bool, generatorLength int, generatorSymbols bool) {
+	if err := util.ValidatePath(path); err != nil {
+		logrus.Fatalf("invalid file path '%s': %s", path, err)
+	}
+
+	// Aliases lead to the secret they point to
+	path = util.ResolveAlias(path)
+
+	meta, attrs := crypt.GetSecret(path)
+	if name == "" {
+		name = defaultAttribute(attrs)
+	}
+
+	attr := attrs[name]
+	switch {
+	case attr == nil:
+		logrus.Fatalf("could not read attribute '%s'", name)
+	case attr.File || attr.Reference != "":
+		logrus.Fatalf("attribute '%s' cannot be changed, only text values can", name)
+	case attr.Pending != nil:
+		// Running the command again gives the pending value back
+		clipPending(path, name, attr.Pending.Value)
+		logrus.Warnf("attribute '%s' already has a pending value, confirm it with --confirm or discard it with --abort", name)
+		return
+	}
+
+	spec := &util.AttributeSpec{Name: name, Type: attr.Type, Source: util.SourceGenerate}
+	switch {
+	case prompt:
+		spec.Source = util.SourcePrompt
+	case generator != "":
+		var err error
+		if spec.Generator, spec.Length, err = util.ParseGenerator(generator); err != nil {
+			logrus.Fatal(err)
+		}
+	case attr.Generator != nil:
+		// Values are generated again the way the current one was
+		spec.Generator = attr.Generator.Kind
+		spec.Length = attr.Generator.Length
+		generatorLength = attr.Generator.Length
+		generatorSymbols = attr.Generator.Symbols
+	}
+
+	if spec.Source == util.SourceGenerate {
+		g, err := util.GetGenerator(spec.Generator)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if g.KeyPair {
+			logrus.Fatalf("key pairs cannot be changed, use 'vault regen' instead")
+		}
+	}
+
+	next, _, err := crypt.ResolveAttribute(spec, generatorLength, generatorSymbols)
+	if err != nil {
+		logrus.Fatalf("invalid attribute '%s': %s", name, err)
+	}
+	if err := util.ValidateAttributeValue(attr.GetType(), next.Value); err != nil {
+		logrus.Fatalf("invalid attribute '%s': %s", name, err)
+	}
+
+	attr.Pending = &util.PendingValue{
+		Value:     next.Value,
+		Generator: next.Generator,
+		Created:   time.Now().Unix(),
+	}
+
+	crypt.SetSecret(path, attrs, meta, true, []string{}, false)
+
+	clipPending(path, name, next.Value)
+	logrus.Infof("confirm the change with 'vault change %s %s --confirm' once the new value is accepted", path, name)
+}
+
+// finishChange confirms or discards the pending values of a secret, those
+// of all its attributes if none is given.
+func finishChange(path, name string, confirm bool) {
+	if err := util.ValidatePath(path); err != nil {
+		logrus.Fatalf("invalid file path '%s': %s", path, err)
+	}
+
+	// Aliases lead to the secret they point to
+	path = util.ResolveAlias(path)
+
+	meta, attrs := crypt.GetSecret(path)
+
+	names := make([]string, 0)
+	if name != "" {
+		if attrs[name] == nil || attrs[name].Pending == nil {
+			logrus.Fatalf("attribute '%s' does not have a pending value", name)
+		}
+		names = append(names, name)
+	} else {
+		for _, k := range attrs.Keys() {
+			if attrs[k].Pending != nil {
+				names = append(names, k)
+			}
+		}
+		if len(names) == 0 {
+			logrus.Fatalf("secret '%s' does not have any pending value", path)
+		}
+	}
+
+	editedAttrs := make([]string, 0)
+	for _, k := range names {
+		if !confirm {
+			attrs[k].Pending = nil
+			logrus.Infof("pending value of attribute '%s' was discarded", k)
+			continue
+		}
+
+		next, err := attrs[k].ConfirmPending(util.ConfigInt("history.size"))
+		if err != nil {
+			logrus.Fatalf("could not confirm attribute '%s': %s", k, err)
+		}
+		attrs[k] = next
+		editedAttrs = append(editedAttrs, k)
+		logrus.Infof("pending value of attribute '%s' was confirmed", k)
+	}
+
+	crypt.SetSecret(path, attrs, meta, true, editedAttrs, false)
+}
+
+func clipPending(path, name, value string) {
+	if err := clipboard.WriteAll(value); err != nil {
+		logrus.Warnf("could not copy the new value to your clipboard: %s", err)
+		return
+	}
+	logrus.Infof("new value of attribute '%s' of '%s' was copied to your clipboard", name, path)
+}
+
+// defaultAttribute returns the attribute acted upon when none is given: the
+// configured one, or the only eyes-only attribute of the secret.
+func defaultAttribute(attrs util.AttributeMap) string {
+	// A configured attribute wins over guessing from eyes-only attributes
+	if _, origin := util.GetConfigValue("clipboard.attribute"); origin == util.ConfigOriginDefault && attrs.EyesOnlyCount() == 1 {
+		return attrs.FindFirstEyesOnly()
+	}
+	return util.ConfigString("clipboard.attribute")
+}
+
+// aliasSecret makes a secret reachable under another path.
+func aliasSecret(path, target string) {
+	if err := util.ValidatePath(path); err != nil {
+		logrus.Fatalf("invalid file path '%s': %s", path, err)
+	}
+	if err := util.ValidatePath(target); err != nil {
+		logrus.Fatalf("invalid file path '%s': %s", target, err)
+	}
+
+	// Aliases always point to the canonical path of a secret
+	target = util.ResolveAlias(target)
+	if _, err := crypt.GetSecretFile(target); err != nil {
+		logrus.Fatal("secret does not exist")
+	}
+	if _, err := os.Stat(util.GetSecretPath(path)); !os.IsNotExist(err) {
+		logrus.Fatal("secret already exists")
+	}
+
+	if err := util.WriteAlias(path, target); err != nil {
+		logrus.Fatalf("could not create alias: %s", err)
+	}
+
+	logrus.Infof("alias '%s' to '%s' created successfully", path, target)
+	util.GitCommit(path, util.GIT_ADD, fmt.Sprintf("Added alias '%s' to '%s'", path, target))
 }
 
 func renameSecret(path, newPath string) {
-	if !util.IsValidPath(path) {
-		logrus.Fatalf("invalid file path: %s", path)
+	if err := util.ValidatePath(path); err != nil {
+		logrus.Fatalf("invalid file path '%s': %s", path, err)
 	}
-	if !util.IsValidPath(newPath) {
-		logrus.Fatalf("invalid file path: %s", newPath)
+	if err := util.ValidatePath(newPath); err != nil {
+		logrus.Fatalf("invalid file path '%s': %s", newPath, err)
 	}
 
-	fullPath := fmt.Sprintf("%s/%s", util.GetVaultPath(), path)
-	fullNewPath := fmt.Sprintf("%s/%s", util.GetVaultPath(), newPath)
+	aliases, err := util.FindAliases(path)
+	if err != nil {
+		logrus.Fatalf("could not list aliases: %s", err)
+	}
+
+	fullPath := util.GetSecretPath(path)
+	fullNewPath := util.GetSecretPath(newPath)
 	dir, _ := filepath.Split(fullNewPath)
 
-	err := os.MkdirAll(dir, 0700)
+	err = os.MkdirAll(dir, 0700)
 	if err != nil {
 		logrus.Fatalf("could not rename secret: %s", err)
 	}
@@ -126,44 +1184,100 @@ func renameSecret(path, newPath string) {
 		logrus.Fatalf("could not rename secret: %s", err)
 	}
 
+	// Aliases follow the secret they point to
+	for _, alias := range aliases {
+		if err := util.WriteAlias(alias, newPath); err != nil {
+			logrus.Fatalf("could not update alias '%s': %s", alias, err)
+		}
+	}
+
 	logrus.Infof("secret '%s' renamed to '%s' successfully", path, newPath)
-	util.GitCommitRename(path, newPath)
+	util.GitCommitRename(path, newPath, aliases...)
 
-	// Remove any empty parent directory
-	for {
-		dir, _ := filepath.Split(filepath.Clean(fullPath))
-		if dir == "" {
-			break
-		}
+	removeEmptyParents(path)
+}
+
+func deleteSecret(path string, removeAliases bool, retargetAliases string) {
+	if err := util.ValidatePath(path); err != nil {
+		logrus.Fatalf("invalid file path '%s': %s", path, err)
+	}
 
-		err := os.Remove(dir)
+	aliases, err := util.FindAliases(path)
+	if err != nil {
+		logrus.Fatalf("could not list aliases: %s", err)
+	}
+
+	// Aliases of the secret are either removed or moved to another secret
+	if len(aliases) > 0 && !removeAliases && retargetAliases == "" {
+		answer, ok, err := crypt.PromptLine(fmt.Sprintf("Aliases %s point to '%s', enter 'remove' to delete them or a secret path to retarget them to (empty to abort)", strings.Join(aliases, ", "), path))
 		if err != nil {
-			return
+			logrus.Fatalf("could not read answer: %s", err)
+		}
+		if !ok {
+			logrus.Fatalf("aliases %s point to '%s', use --remove-aliases or --retarget-aliases", strings.Join(aliases, ", "), path)
+		}
+
+		switch answer {
+		case "":
+			logrus.Fatal("secret was not deleted")
+		case "remove":
+			removeAliases = true
+		default:
+			retargetAliases = answer
 		}
-		fullPath = dir
 	}
-}
 
-func deleteSecret(path string) {
-	if !util.IsValidPath(path) {
-		logrus.Fatalf("invalid file path: %s", path)
+	if len(aliases) > 0 && retargetAliases != "" {
+		if err := util.ValidatePath(retargetAliases); err != nil {
+			logrus.Fatalf("invalid file path '%s': %s", retargetAliases, err)
+		}
+		retargetAliases = util.ResolveAlias(retargetAliases)
+		if retargetAliases == path {
+			logrus.Fatal("cannot retarget aliases to the deleted secret")
+		}
+		if _, err := crypt.GetSecretFile(retargetAliases); err != nil {
+			logrus.Fatalf("secret '%s' does not exist", retargetAliases)
+		}
 	}
 
-	err := os.Remove(fmt.Sprintf("%s/%s", util.GetVaultPath(), path))
+	err = os.Remove(util.GetSecretPath(path))
 	if err != nil {
 		logrus.Fatalf("could not remove secret: %s", err)
 	}
 
+	for _, alias := range aliases {
+		if removeAliases {
+			if err := os.Remove(util.GetSecretPath(alias)); err != nil {
+				logrus.Fatalf("could not remove alias '%s': %s", alias, err)
+			}
+			logrus.Infof("alias '%s' deleted", alias)
+			removeEmptyParents(alias)
+		} else {
+			if err := util.WriteAlias(alias, retargetAliases); err != nil {
+				logrus.Fatalf("could not update alias '%s': %s", alias, err)
+			}
+			logrus.Infof("alias '%s' now points to '%s'", alias, retargetAliases)
+		}
+	}
+
 	logrus.Infof("secret '%s' deleted successfully", path)
-	util.GitCommit(path, util.GIT_DELETE, "")
+	if len(aliases) > 0 {
+		util.GitCommit("-A", util.GIT_DELETE, fmt.Sprintf("Deleted secret '%s'", path))
+	} else {
+		util.GitCommit(path, util.GIT_DELETE, "")
+	}
 
-	// Remove any empty parent directory
+	removeEmptyParents(path)
+}
+
+// removeEmptyParents removes the directories of a secret path left empty.
+func removeEmptyParents(path string) {
 	for {
 		dir, _ := filepath.Split(filepath.Clean(path))
 		if dir == "" {
 			break
 		}
-		err := os.Remove(fmt.Sprintf("%s/%s", util.GetVaultPath(), dir))
+		err := os.Remove(util.GetSecretPath(dir))
 		if err != nil {
 			return
 		}
@@ -239,3 +1353,17 @@ func WriteFiles(path string, attrs util.AttributeMap, writeFiles []string, write
 		logrus.Infof("attribute written to '%s'", fileName)
 	}
 }
+
+// splitList flattens flags that can be given either repeatedly or as
+// comma-separated lists.
+func splitList(values []string) []string {
+	items := make([]string, 0)
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
@@ -0,0 +1,74 @@
+package util
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// SecretAlias is stored in place of a secret to make it reachable under
+// another path, without duplicating its content.
+type SecretAlias struct {
+	Alias string `json:"alias"`
+}
+
+// GetAliasTarget returns the path an alias points to, or an empty string if
+// the path holds a secret.
+func GetAliasTarget(path string) (string, error) {
+	content, err := ioutil.ReadFile(GetSecretPath(path))
+	if err != nil {
+		return "", err
+	}
+
+	var alias SecretAlias
+	if err := json.Unmarshal(content, &alias); err != nil {
+		return "", err
+	}
+
+	return alias.Alias, nil
+}
+
+// ResolveAlias returns the canonical path of a secret, following the alias
+// stored at the given path if there is one.
+func ResolveAlias(path string) string {
+	target, err := GetAliasTarget(path)
+	if err != nil || target == "" {
+		return path
+	}
+
+	return target
+}
+
+// FindAliases lists the aliases pointing to a secret.
+func FindAliases(target string) ([]string, error) {
+	paths, err := ListSecretPaths("/")
+	if err != nil {
+		return nil, err
+	}
+
+	aliases := make([]string, 0)
+	for _, path := range paths {
+		if alias, _ := GetAliasTarget(path); alias == target {
+			aliases = append(aliases, path)
+		}
+	}
+
+	return aliases, nil
+}
+
+func WriteAlias(path, target string) error {
+	filePath := GetSecretPath(path)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(SecretAlias{Alias: target})
+	if err != nil {
+		logrus.Fatalf("could not marshal alias: %s", err)
+	}
+
+	return ioutil.WriteFile(filePath, content, 0600)
+}
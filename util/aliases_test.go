@@ -0,0 +1,40 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAliases(t *testing.T) {
+	defer withConfigDir(t)()
+
+	dir, err := ioutil.TempDir("", "vault-aliases")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	vaultDir = dir
+	vaultSelected = true
+
+	assert.Nil(t, os.MkdirAll(dir+"/work/dev", 0700))
+	assert.Nil(t, ioutil.WriteFile(dir+"/work/dev/github", []byte(`{"salt":"","nonce":"","data":""}`), 0600))
+	assert.Nil(t, WriteAlias("github", "work/dev/github"))
+	assert.Nil(t, WriteAlias("shortcuts/gh", "work/dev/github"))
+
+	target, err := GetAliasTarget("github")
+	assert.Nil(t, err)
+	assert.Equal(t, "work/dev/github", target)
+
+	target, err = GetAliasTarget("work/dev/github")
+	assert.Nil(t, err)
+	assert.Equal(t, "", target, "secrets should not be aliases")
+
+	assert.Equal(t, "work/dev/github", ResolveAlias("shortcuts/gh"))
+	assert.Equal(t, "work/dev/github", ResolveAlias("work/dev/github"))
+	assert.Equal(t, "unknown", ResolveAlias("unknown"))
+
+	aliases, err := FindAliases("work/dev/github")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"github", "shortcuts/gh"}, aliases)
+}
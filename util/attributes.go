@@ -0,0 +1,196 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Where the value of an attribute given on the command line comes from.
+const (
+	SourceLiteral = iota
+	SourcePrompt
+	SourceGenerate
+	SourceFile
+	SourceStdin
+	SourceReference
+)
+
+const (
+	ModifierEyes   = "eyes"
+	ModifierRaw    = "raw"
+	ModifierPrompt = "prompt"
+	ModifierGen    = "gen"
+	ModifierFile   = "file"
+	ModifierStdin  = "stdin"
+)
+
+var attributeModifiers = []string{ModifierEyes, ModifierRaw, ModifierPrompt, ModifierGen, ModifierFile, ModifierStdin}
+
+// AttributeSpec describes an attribute given on the command line as
+// 'name[:modifier...]=value', before its value is resolved. Generated
+// attributes carry the kind of generator and the length asked for, if any.
+type AttributeSpec struct {
+	Name      string
+	Type      string
+	Source    int
+	Value     string
+	EyesOnly  bool
+	Generator string
+	Length    int
+}
+
+// ParseAttributeArgs reads 'key=value' command-line arguments, keeping the
+// order in which keys were given.
+func ParseAttributeArgs(args []string) ([]string, map[string]string, error) {
+	keys := make([]string, 0, len(args))
+	values := make(map[string]string)
+
+	for _, arg := range args {
+		tokens := strings.SplitN(arg, "=", 2)
+		if len(tokens) != 2 {
+			return nil, nil, fmt.Errorf("expected key=value, got '%s'", arg)
+		}
+		if _, ok := values[tokens[0]]; !ok {
+			keys = append(keys, tokens[0])
+		}
+		values[tokens[0]] = tokens[1]
+	}
+
+	return keys, values, nil
+}
+
+// ParseAttributeSpecs parses every attribute argument of add and edit, in
+// the order they were given.
+func ParseAttributeSpecs(args []string) ([]*AttributeSpec, error) {
+	keys, values, err := ParseAttributeArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make([]*AttributeSpec, 0, len(keys))
+	names := make([]string, 0, len(keys))
+	stdin := false
+	for _, k := range keys {
+		spec, err := ParseAttributeSpec(k, values[k])
+		if err != nil {
+			return nil, err
+		}
+		if StringArrayContains(names, spec.Name) {
+			return nil, fmt.Errorf("attribute '%s' given more than once", spec.Name)
+		}
+		if spec.Source == SourceGenerate {
+			// The public half of a key pair goes to an attribute of its own
+			if generator, _ := GetGenerator(spec.Generator); generator.KeyPair {
+				if StringArrayContains(names, spec.Name+PublicSuffix) {
+					return nil, fmt.Errorf("attribute '%s' given more than once", spec.Name+PublicSuffix)
+				}
+				names = append(names, spec.Name+PublicSuffix)
+			}
+		}
+		if spec.Source == SourceStdin {
+			if stdin {
+				return nil, fmt.Errorf("only one attribute can be read from STDIN")
+			}
+			stdin = true
+		}
+
+		specs = append(specs, spec)
+		names = append(names, spec.Name)
+	}
+
+	return specs, nil
+}
+
+// ParseAttributeSpec parses a single attribute. The key is made of the
+// attribute name, optionally followed by a type and modifiers, all separated
+// by colons. Without any modifier, an empty value is prompted for as
+// eyes-only, '-' is generated as a password and '-kind[:length]' with
+// another generator, '@path' is read from a file and 'ref:path#attr'
+// references an attribute of another secret.
+func ParseAttributeSpec(key, value string) (*AttributeSpec, error) {
+	tokens := strings.Split(key, ":")
+	if tokens[0] == "" {
+		return nil, fmt.Errorf("empty attribute name in '%s'", key)
+	}
+
+	spec := &AttributeSpec{Name: tokens[0], Source: -1, Value: value}
+
+	for _, token := range tokens[1:] {
+		switch {
+		case token == ModifierEyes:
+			spec.EyesOnly = true
+		case StringArrayContains(attributeModifiers, token):
+			if spec.Source != -1 {
+				return nil, fmt.Errorf("attribute '%s' can only use one of the raw, prompt, gen, file and stdin modifiers", spec.Name)
+			}
+			spec.Source = modifierSource(token)
+		case IsValidAttributeType(token):
+			if spec.Type != "" {
+				return nil, fmt.Errorf("attribute '%s' can only have one type", spec.Name)
+			}
+			spec.Type = token
+		default:
+			return nil, fmt.Errorf("unknown attribute type or modifier '%s', must be one of %s, %s", token, strings.Join(AttributeTypes, ", "), strings.Join(attributeModifiers, ", "))
+		}
+	}
+
+	switch spec.Source {
+	case -1:
+		// Historical shorthands
+		switch {
+		case value == "":
+			spec.Source = SourcePrompt
+		case value == "-":
+			spec.Source = SourceGenerate
+		case value[0] == '-' && IsGenerator(value[1:]):
+			spec.Source = SourceGenerate
+			spec.Generator, spec.Length, _ = ParseGenerator(value[1:])
+		case value[0] == '@':
+			spec.Source = SourceFile
+			spec.Value = value[1:]
+		case strings.HasPrefix(value, ReferencePrefix) && strings.Contains(value, "#"):
+			// Values such as ref:1234, without an attribute, stay literal
+			spec.Source = SourceReference
+			spec.Value = strings.TrimPrefix(value, ReferencePrefix)
+			if _, _, err := ParseReference(spec.Value); err != nil {
+				return nil, err
+			}
+		default:
+			spec.Source = SourceLiteral
+		}
+	case SourceGenerate:
+		var err error
+		if spec.Generator, spec.Length, err = ParseGenerator(value); err != nil {
+			return nil, fmt.Errorf("attribute '%s': %s", spec.Name, err)
+		}
+	case SourcePrompt, SourceStdin:
+		if value != "" {
+			return nil, fmt.Errorf("attribute '%s' does not take a value with this modifier", spec.Name)
+		}
+	case SourceFile:
+		if value == "" {
+			return nil, fmt.Errorf("attribute '%s' needs a file path", spec.Name)
+		}
+	}
+
+	// Reading content from a file makes it a file attribute, unless told otherwise
+	if spec.Source == SourceFile && spec.Type == "" {
+		spec.Type = AttributeFile
+	}
+
+	return spec, nil
+}
+
+func modifierSource(modifier string) int {
+	switch modifier {
+	case ModifierPrompt:
+		return SourcePrompt
+	case ModifierGen:
+		return SourceGenerate
+	case ModifierFile:
+		return SourceFile
+	case ModifierStdin:
+		return SourceStdin
+	}
+	return SourceLiteral
+}
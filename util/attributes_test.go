@@ -0,0 +1,147 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttributeSpecShorthands(t *testing.T) {
+	cases := []struct {
+		value  string
+		source int
+		parsed string
+	}{
+		{"apognu", SourceLiteral, "apognu"},
+		{"", SourcePrompt, ""},
+		{"-", SourceGenerate, "-"},
+		{"@/tmp/key", SourceFile, "/tmp/key"},
+	}
+
+	for _, c := range cases {
+		spec, err := ParseAttributeSpec("attr", c.value)
+		assert.Nil(t, err)
+		assert.Equal(t, "attr", spec.Name)
+		assert.Equal(t, c.source, spec.Source, "wrong source for '%s'", c.value)
+		assert.Equal(t, c.parsed, spec.Value)
+	}
+}
+
+func TestAttributeSpecModifiers(t *testing.T) {
+	spec, err := ParseAttributeSpec("password:eyes", "hunter2")
+	assert.Nil(t, err)
+	assert.Equal(t, SourceLiteral, spec.Source)
+	assert.True(t, spec.EyesOnly)
+
+	spec, err = ParseAttributeSpec("literal:raw", "@foo")
+	assert.Nil(t, err)
+	assert.Equal(t, SourceLiteral, spec.Source)
+	assert.Equal(t, "@foo", spec.Value)
+
+	spec, err = ParseAttributeSpec("dash:raw", "-")
+	assert.Nil(t, err)
+	assert.Equal(t, SourceLiteral, spec.Source)
+
+	spec, err = ParseAttributeSpec("note:stdin", "")
+	assert.Nil(t, err)
+	assert.Equal(t, SourceStdin, spec.Source)
+
+	spec, err = ParseAttributeSpec("cert:file", "/tmp/cert.pem")
+	assert.Nil(t, err)
+	assert.Equal(t, SourceFile, spec.Source)
+	assert.Equal(t, "/tmp/cert.pem", spec.Value)
+	assert.Equal(t, AttributeFile, spec.Type)
+
+	spec, err = ParseAttributeSpec("cert:pem:file", "/tmp/cert.pem")
+	assert.Nil(t, err)
+	assert.Equal(t, AttributePEM, spec.Type)
+
+	spec, err = ParseAttributeSpec("readme:note:file", "README")
+	assert.Nil(t, err)
+	assert.Equal(t, AttributeNote, spec.Type)
+
+	spec, err = ParseAttributeSpec("website:url:eyes", "https://example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, AttributeURL, spec.Type)
+	assert.True(t, spec.EyesOnly)
+}
+
+func TestInvalidAttributeSpecs(t *testing.T) {
+	invalid := map[string]string{
+		":url":             "https://example.com",
+		"attr:unknown":     "value",
+		"attr:raw:stdin":   "",
+		"attr:url:email":   "value",
+		"attr:stdin":       "value",
+		"attr:gen":         "value",
+		"attr:file":        "",
+		"attr:prompt:eyes": "value",
+	}
+
+	for key, value := range invalid {
+		_, err := ParseAttributeSpec(key, value)
+		assert.NotNil(t, err, "'%s=%s' should be rejected", key, value)
+	}
+
+	_, err := ParseAttributeSpecs([]string{"a:stdin=", "b:stdin="})
+	assert.NotNil(t, err, "only one attribute should be read from STDIN")
+
+	_, err = ParseAttributeSpecs([]string{"a=1", "a:url=http://example.com"})
+	assert.NotNil(t, err, "attributes should not be given twice")
+}
+
+func TestParseReferenceSpec(t *testing.T) {
+	spec, err := ParseAttributeSpec("password", "ref:infra/svc-account#password")
+	assert.Nil(t, err)
+	assert.Equal(t, SourceReference, spec.Source)
+	assert.Equal(t, "infra/svc-account#password", spec.Value)
+
+	spec, err = ParseAttributeSpec("password:raw", "ref:infra/svc-account#password")
+	assert.Nil(t, err)
+	assert.Equal(t, SourceLiteral, spec.Source, "raw values should not be references")
+
+	_, err = ParseAttributeSpec("password", "ref:infra/svc-account#")
+	assert.NotNil(t, err, "references need an attribute name")
+	_, err = ParseAttributeSpec("password", "ref:../etc#password")
+	assert.NotNil(t, err, "references need a valid secret path")
+
+	// Values that cannot be references are kept as is
+	for _, value := range []string{"ref:1234", "ref:infra/svc-account"} {
+		spec, err = ParseAttributeSpec("note", value)
+		assert.Nil(t, err)
+		assert.Equal(t, SourceLiteral, spec.Source, value)
+	}
+}
+
+func TestGeneratorSpecs(t *testing.T) {
+	spec, err := ParseAttributeSpec("token", "-hex:16")
+	assert.Nil(t, err)
+	assert.Equal(t, SourceGenerate, spec.Source)
+	assert.Equal(t, "hex", spec.Generator)
+	assert.Equal(t, 16, spec.Length)
+
+	spec, err = ParseAttributeSpec("id:gen", "uuid")
+	assert.Nil(t, err)
+	assert.Equal(t, SourceGenerate, spec.Source)
+	assert.Equal(t, "uuid", spec.Generator)
+
+	spec, err = ParseAttributeSpec("password", "-")
+	assert.Nil(t, err)
+	assert.Equal(t, "", spec.Generator, "'-' should generate a password")
+
+	spec, err = ParseAttributeSpec("offset", "-5")
+	assert.Nil(t, err)
+	assert.Equal(t, SourceLiteral, spec.Source, "values that do not name a generator should be kept")
+
+	_, err = ParseAttributeSpec("id:gen", "uuid:12")
+	assert.NotNil(t, err, "UUIDs do not have a length")
+	_, err = ParseAttributeSpec("token:gen", "hex:0")
+	assert.NotNil(t, err)
+
+	_, err = ParseAttributeSpecs([]string{"wg=-wireguard", "wg_pub=key"})
+	assert.NotNil(t, err, "the public half of a key pair should not be given")
+	_, err = ParseAttributeSpecs([]string{"wg_pub=key", "wg=-wireguard"})
+	assert.NotNil(t, err, "the public half of a key pair should not be given")
+	_, err = ParseAttributeSpecs([]string{"token=-hex", "token_pub=key"})
+	assert.Nil(t, err)
+}
@@ -0,0 +1,162 @@
+package util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Certificate describes an X.509 certificate stored in an attribute.
+type Certificate struct {
+	Path        string    `json:"path"`
+	Attribute   string    `json:"attribute"`
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	SANs        []string  `json:"sans,omitempty"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+	Fingerprint string    `json:"fingerprint"`
+	Key         string    `json:"key,omitempty"`
+}
+
+// pemBlocks decodes the PEM blocks of a file attribute.
+func pemBlocks(attr *Attribute) []*pem.Block {
+	if !attr.File {
+		return nil
+	}
+
+	content, err := base64.StdEncoding.DecodeString(attr.Value)
+	if err != nil {
+		return nil
+	}
+
+	blocks := make([]*pem.Block, 0)
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks
+}
+
+// ParseCertificates returns the certificates stored in a file attribute, in
+// the order they appear, usually starting with the leaf certificate.
+func ParseCertificates(attr *Attribute) []*x509.Certificate {
+	certs := make([]*x509.Certificate, 0)
+	for _, block := range pemBlocks(attr) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+
+	return certs
+}
+
+// parsePublicKeys returns the public halves of the unencrypted private keys
+// stored in a file attribute.
+func parsePublicKeys(attr *Attribute) []crypto.PublicKey {
+	keys := make([]crypto.PublicKey, 0)
+	for _, block := range pemBlocks(attr) {
+		var key interface{}
+		var err error
+
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		default:
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			keys = append(keys, k.Public())
+		case *ecdsa.PrivateKey:
+			keys = append(keys, k.Public())
+		case crypto.Signer:
+			keys = append(keys, k.Public())
+		}
+	}
+
+	return keys
+}
+
+// FindCertificateKey returns the name of the attribute holding the private
+// key of a certificate, or an empty string if the secret does not hold it.
+func FindCertificateKey(cert *x509.Certificate, attrs AttributeMap) string {
+	certKey, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil {
+		return ""
+	}
+
+	for _, k := range attrs.Keys() {
+		for _, pub := range parsePublicKeys(attrs[k]) {
+			if key, err := x509.MarshalPKIXPublicKey(pub); err == nil && bytes.Equal(key, certKey) {
+				return k
+			}
+		}
+	}
+
+	return ""
+}
+
+func DescribeCertificate(path, attribute string, cert *x509.Certificate, attrs AttributeMap) Certificate {
+	sans := make([]string, 0)
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+
+	return Certificate{
+		Path:        path,
+		Attribute:   attribute,
+		Subject:     cert.Subject.String(),
+		Issuer:      cert.Issuer.String(),
+		SANs:        sans,
+		NotBefore:   cert.NotBefore,
+		NotAfter:    cert.NotAfter,
+		Fingerprint: fmt.Sprintf("%x", sha256.Sum256(cert.Raw)),
+		Key:         FindCertificateKey(cert, attrs),
+	}
+}
+
+// SecretCertificates describes every certificate stored in a secret.
+func SecretCertificates(path string, attrs AttributeMap) []Certificate {
+	certs := make([]Certificate, 0)
+	for _, k := range attrs.Keys() {
+		for _, cert := range ParseCertificates(attrs[k]) {
+			certs = append(certs, DescribeCertificate(path, k, cert, attrs))
+		}
+	}
+
+	return certs
+}
+
+// SortCertificates orders certificates by expiration date, soonest first.
+func SortCertificates(certs []Certificate) {
+	sort.SliceStable(certs, func(i, j int) bool {
+		return certs[i].NotAfter.Before(certs[j].NotAfter)
+	})
+}
@@ -0,0 +1,85 @@
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func generateCertificate(t *testing.T, name string, notAfter time.Time) (*Attribute, *Attribute) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name, "www." + name},
+		IPAddresses:  []net.IP{net.ParseIP("10.0.0.1")},
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	priv := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	return &Attribute{Value: base64.StdEncoding.EncodeToString(cert), File: true, Type: AttributePEM},
+		&Attribute{Value: base64.StdEncoding.EncodeToString(priv), File: true, Type: AttributePEM}
+}
+
+func TestCertificates(t *testing.T) {
+	notAfter := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert, key := generateCertificate(t, "example.com", notAfter)
+	_, otherKey := generateCertificate(t, "example.org", notAfter)
+
+	attrs := AttributeMap{
+		"cert":     cert,
+		"other":    otherKey,
+		"key":      key,
+		"username": &Attribute{Value: "admin"},
+	}
+	attrs.Reorder([]string{"cert", "other", "key"})
+
+	assert.Equal(t, 1, len(ParseCertificates(cert)))
+	assert.Equal(t, 0, len(ParseCertificates(key)), "private keys are not certificates")
+	assert.Equal(t, 0, len(ParseCertificates(attrs["username"])))
+
+	certs := SecretCertificates("web/tls", attrs)
+	assert.Equal(t, 1, len(certs))
+	assert.Equal(t, "cert", certs[0].Attribute)
+	assert.Equal(t, "CN=example.com", certs[0].Subject)
+	assert.Equal(t, "CN=example.com", certs[0].Issuer)
+	assert.Equal(t, []string{"example.com", "www.example.com", "10.0.0.1"}, certs[0].SANs)
+	assert.Equal(t, notAfter, certs[0].NotAfter.UTC())
+	assert.Equal(t, "key", certs[0].Key, "the certificate should match its private key only")
+
+	delete(attrs, "key")
+	assert.Equal(t, "", SecretCertificates("web/tls", attrs)[0].Key)
+}
+
+func TestSortCertificates(t *testing.T) {
+	now := time.Now()
+	certs := []Certificate{
+		{Path: "late", NotAfter: now.Add(48 * time.Hour)},
+		{Path: "expired", NotAfter: now.Add(-48 * time.Hour)},
+		{Path: "soon", NotAfter: now.Add(time.Hour)},
+	}
+
+	SortCertificates(certs)
+	assert.Equal(t, "expired", certs[0].Path)
+	assert.Equal(t, "soon", certs[1].Path)
+	assert.Equal(t, "late", certs[2].Path)
+}
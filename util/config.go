@@ -0,0 +1,282 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/Sirupsen/logrus"
+	"github.com/fatih/color"
+)
+
+const (
+	configString = iota
+	configInt
+	configBool
+	configDuration
+)
+
+// configKeys lists every supported setting and the type of its value.
+var configKeys = map[string]int{
+	"generator.length":    configInt,
+	"generator.symbols":   configBool,
+	"clipboard.attribute": configString,
+	"history.size":        configInt,
+	"git.autopush":        configBool,
+	"git.remote":          configString,
+	"git.branch":          configString,
+	"output.color":        configString,
+	"seal.timeout":        configDuration,
+	"expiry.warning":      configDuration,
+}
+
+var configDefaults = map[string]interface{}{
+	"generator.length":    int64(16),
+	"generator.symbols":   false,
+	"clipboard.attribute": "password",
+	"history.size":        int64(10),
+	"git.autopush":        false,
+	"git.remote":          "origin",
+	"git.branch":          "master",
+	"output.color":        "auto",
+	"seal.timeout":        "0s",
+	"expiry.warning":      "30d",
+}
+
+const (
+	ConfigOriginDefault  = "default"
+	ConfigOriginGlobal   = "global"
+	ConfigOriginVault    = "vault"
+	ConfigOriginOverride = "flag"
+)
+
+var (
+	config          = make(map[string]interface{})
+	configOverrides = make(map[string]interface{})
+)
+
+func GetConfigPath() string {
+	return filepath.Join(GetConfigDir(), "config.toml")
+}
+
+// LoadConfig reads the user configuration file. Global settings live at the
+// root of the document, settings of a named vault in a [vaults.<name>] table.
+func LoadConfig() error {
+	doc := make(map[string]interface{})
+	if _, err := toml.DecodeFile(GetConfigPath(), &doc); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	config = doc
+
+	return nil
+}
+
+func saveConfig() error {
+	if err := os.MkdirAll(GetConfigDir(), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(GetConfigPath(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return toml.NewEncoder(file).Encode(config)
+}
+
+// OverrideConfig sets a value for the lifetime of the process, taking
+// precedence over the configuration file. It is used for command-line flags.
+func OverrideConfig(key string, value interface{}) {
+	configOverrides[key] = value
+}
+
+// GetConfigValue returns the effective value of a setting, and where it
+// comes from.
+func GetConfigValue(key string) (interface{}, string) {
+	if value, ok := configOverrides[key]; ok {
+		return value, ConfigOriginOverride
+	}
+	if vaultName != "" {
+		if vaults, ok := config["vaults"].(map[string]interface{}); ok {
+			if section, ok := vaults[vaultName].(map[string]interface{}); ok {
+				if value, ok := lookupConfig(section, key); ok {
+					return value, ConfigOriginVault
+				}
+			}
+		}
+	}
+	if value, ok := lookupConfig(config, key); ok {
+		return value, ConfigOriginGlobal
+	}
+
+	return configDefaults[key], ConfigOriginDefault
+}
+
+func ConfigString(key string) string {
+	value, _ := GetConfigValue(key)
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return configDefaults[key].(string)
+}
+
+func ConfigInt(key string) int {
+	value, _ := GetConfigValue(key)
+	switch i := value.(type) {
+	case int64:
+		return int(i)
+	case int:
+		return i
+	}
+	return int(configDefaults[key].(int64))
+}
+
+func ConfigBool(key string) bool {
+	value, _ := GetConfigValue(key)
+	if b, ok := value.(bool); ok {
+		return b
+	}
+	return configDefaults[key].(bool)
+}
+
+func ConfigDuration(key string) time.Duration {
+	d, err := ParseDuration(ConfigString(key))
+	if err != nil {
+		d, _ = ParseDuration(configDefaults[key].(string))
+	}
+	return d
+}
+
+// ApplyConfig applies settings that affect the process as a whole.
+func ApplyConfig() {
+	switch ConfigString("output.color") {
+	case "always":
+		color.NoColor = false
+	case "never":
+		color.NoColor = true
+	}
+}
+
+func lookupConfig(doc map[string]interface{}, key string) (interface{}, bool) {
+	tokens := strings.Split(key, ".")
+
+	var current interface{} = doc
+	for _, token := range tokens {
+		table, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = table[token]; !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+func setConfig(doc map[string]interface{}, key string, value interface{}) {
+	tokens := strings.Split(key, ".")
+
+	table := doc
+	for _, token := range tokens[:len(tokens)-1] {
+		next, ok := table[token].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			table[token] = next
+		}
+		table = next
+	}
+
+	table[tokens[len(tokens)-1]] = value
+}
+
+// ParseConfigValue validates a raw value for the given setting and converts
+// it to the type stored in the configuration file.
+func ParseConfigValue(key, raw string) (interface{}, error) {
+	kind, ok := configKeys[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown setting '%s'", key)
+	}
+
+	switch kind {
+	case configInt:
+		i, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("'%s' expects a non-negative integer", key)
+		}
+		if i == 0 && key == "generator.length" {
+			return nil, fmt.Errorf("'%s' expects a positive integer", key)
+		}
+		return i, nil
+	case configBool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' expects a boolean", key)
+		}
+		return b, nil
+	case configDuration:
+		if _, err := ParseDuration(raw); err != nil {
+			return nil, fmt.Errorf("'%s' expects a duration such as 30m, 8h or 30d", key)
+		}
+		return raw, nil
+	}
+
+	if key == "output.color" && !StringArrayContains([]string{"auto", "always", "never"}, raw) {
+		return nil, fmt.Errorf("'%s' expects one of auto, always or never", key)
+	}
+
+	return raw, nil
+}
+
+func ConfigKeys() []string {
+	keys := make([]string, 0, len(configKeys))
+	for key := range configKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func ShowConfig(key string) {
+	if _, ok := configKeys[key]; !ok {
+		logrus.Fatalf("unknown setting '%s'", key)
+	}
+
+	value, _ := GetConfigValue(key)
+	fmt.Println(value)
+}
+
+func ListConfig() {
+	FormatConfig(ConfigKeys())
+}
+
+func SetConfig(key, raw string, vault bool) {
+	value, err := ParseConfigValue(key, raw)
+	if err != nil {
+		logrus.Fatalf("could not set setting: %s", err)
+	}
+
+	path := key
+	if vault {
+		if vaultName == "" {
+			logrus.Fatal("per-vault settings require a named vault, see 'vault vaults'")
+		}
+		path = fmt.Sprintf("vaults.%s.%s", vaultName, key)
+	}
+
+	setConfig(config, path, value)
+
+	if err := saveConfig(); err != nil {
+		logrus.Fatalf("could not write configuration: %s", err)
+	}
+
+	logrus.Infof("setting '%s' set to '%v'", key, value)
+}
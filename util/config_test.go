@@ -0,0 +1,64 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigDefaults(t *testing.T) {
+	defer withConfigDir(t)()
+	assert.Nil(t, LoadConfig())
+
+	assert.Equal(t, 16, ConfigInt("generator.length"))
+	assert.Equal(t, false, ConfigBool("generator.symbols"))
+	assert.Equal(t, "origin", ConfigString("git.remote"))
+	assert.Equal(t, time.Duration(0), ConfigDuration("seal.timeout"))
+
+	_, origin := GetConfigValue("generator.length")
+	assert.Equal(t, ConfigOriginDefault, origin)
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	defer withConfigDir(t)()
+
+	registry, _ := LoadVaultRegistry()
+	registry.Add("team", "/tmp/team")
+	registry.Save()
+	assert.Nil(t, SelectVault("team"))
+	assert.Nil(t, LoadConfig())
+
+	SetConfig("generator.length", "24", false)
+	SetConfig("generator.symbols", "true", false)
+	SetConfig("generator.length", "32", true)
+
+	// Settings should survive a reload from disk
+	assert.Nil(t, LoadConfig())
+
+	value, origin := GetConfigValue("generator.length")
+	assert.Equal(t, int64(32), value, "per-vault setting should win over global setting")
+	assert.Equal(t, ConfigOriginVault, origin)
+	assert.Equal(t, true, ConfigBool("generator.symbols"), "global setting should apply to every vault")
+
+	OverrideConfig("generator.length", int64(8))
+	defer delete(configOverrides, "generator.length")
+	assert.Equal(t, 8, ConfigInt("generator.length"), "flags should win over the configuration file")
+}
+
+func TestParseConfigValue(t *testing.T) {
+	value, err := ParseConfigValue("generator.length", "24")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(24), value)
+
+	_, err = ParseConfigValue("generator.length", "-2")
+	assert.NotNil(t, err)
+	_, err = ParseConfigValue("git.autopush", "maybe")
+	assert.NotNil(t, err)
+	_, err = ParseConfigValue("seal.timeout", "forever")
+	assert.NotNil(t, err)
+	_, err = ParseConfigValue("output.color", "rainbow")
+	assert.NotNil(t, err)
+	_, err = ParseConfigValue("unknown.key", "value")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,285 @@
+package util
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// DocumentKeepFile stands for the current content of a file attribute
+	DocumentKeepFile = "keep"
+
+	documentHeader = `# Secret '%s'
+#
+# Save the document to apply your changes, or quit without saving to leave
+# the secret untouched. Attributes are listed in order, either as
+# 'name: value' or with details:
+#
+#   name:
+#     value: ...            # or 'ref: path#attr' to reference an attribute
+#     type: password        # %s
+#     eyes-only: true
+#     expires: YYYY-MM-DD   # or a duration such as 90d
+#
+# File attributes read 'file: %s' to keep their content, set it to
+# '@/path/to/file' to replace it. Renaming an attribute loses its history.
+
+`
+)
+
+// SecretDocument is a secret as edited in a text editor, as YAML.
+type SecretDocument struct {
+	Tags       []string
+	Notes      string
+	Expires    string
+	Attributes []*DocumentAttribute
+}
+
+// DocumentAttribute is an attribute of a secret document. Plain text
+// attributes are written as a bare value.
+type DocumentAttribute struct {
+	Name      string `yaml:"-"`
+	Value     string `yaml:"value,omitempty"`
+	Reference string `yaml:"ref,omitempty"`
+	File      string `yaml:"file,omitempty"`
+	Type      string `yaml:"type,omitempty"`
+	EyesOnly  bool   `yaml:"eyes-only,omitempty"`
+	Expires   string `yaml:"expires,omitempty"`
+}
+
+type documentMeta struct {
+	Tags    []string `yaml:"tags,omitempty"`
+	Notes   string   `yaml:"notes,omitempty"`
+	Expires string   `yaml:"expires,omitempty"`
+}
+
+func (a *DocumentAttribute) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err == nil {
+		a.Value = value
+		return nil
+	}
+
+	type plain DocumentAttribute
+	return unmarshal((*plain)(a))
+}
+
+// MarshalSecretDocument writes a secret as a YAML document, preceded by
+// instructions in comments.
+func MarshalSecretDocument(path string, meta *SecretMeta, attrs AttributeMap) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, documentHeader, path, strings.Join(AttributeTypes, ", "), DocumentKeepFile)
+
+	data, err := yaml.Marshal(documentMeta{Tags: meta.Tags, Notes: meta.Notes, Expires: meta.Expires})
+	if err != nil {
+		return nil, err
+	}
+	if string(data) != "{}\n" {
+		buf.Write(data)
+	}
+
+	document := yaml.MapSlice{}
+	for _, k := range attrs.Keys() {
+		document = append(document, yaml.MapItem{Key: k, Value: documentAttribute(attrs[k])})
+	}
+
+	data, err = yaml.Marshal(yaml.MapSlice{{Key: "attributes", Value: document}})
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(data)
+
+	return buf.Bytes(), nil
+}
+
+func documentAttribute(attr *Attribute) interface{} {
+	if !attr.EyesOnly && !attr.File && attr.Reference == "" && attr.Expires == "" && (attr.Type == "" || attr.Type == AttributeText) {
+		return attr.Value
+	}
+
+	doc := &DocumentAttribute{
+		Reference: attr.Reference,
+		Type:      attr.Type,
+		EyesOnly:  attr.EyesOnly,
+		Expires:   attr.Expires,
+	}
+	switch {
+	case attr.File:
+		doc.File = DocumentKeepFile
+	case attr.Reference == "":
+		doc.Value = attr.Value
+	}
+
+	return doc
+}
+
+// ParseSecretDocument reads a secret document written by
+// MarshalSecretDocument and edited.
+func ParseSecretDocument(data []byte) (*SecretDocument, error) {
+	var meta documentMeta
+	if err := yaml.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+
+	// Attributes are read twice: in order first, then with their details
+	var ordered struct {
+		Attributes yaml.MapSlice `yaml:"attributes"`
+	}
+	var attributes struct {
+		Attributes map[string]*DocumentAttribute `yaml:"attributes"`
+	}
+	if err := yaml.Unmarshal(data, &ordered); err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &attributes); err != nil {
+		return nil, err
+	}
+
+	doc := &SecretDocument{Tags: meta.Tags, Notes: meta.Notes, Expires: meta.Expires}
+	names := make([]string, 0, len(ordered.Attributes))
+	for _, item := range ordered.Attributes {
+		name, ok := item.Key.(string)
+		if !ok {
+			return nil, fmt.Errorf("attribute name '%v' should be quoted", item.Key)
+		}
+		if StringArrayContains(names, name) {
+			return nil, fmt.Errorf("attribute '%s' is given more than once", name)
+		}
+		names = append(names, name)
+
+		attr := attributes.Attributes[name]
+		if attr == nil {
+			attr = &DocumentAttribute{}
+		}
+		attr.Name = name
+		if err := attr.check(); err != nil {
+			return nil, err
+		}
+
+		doc.Attributes = append(doc.Attributes, attr)
+	}
+
+	if len(doc.Attributes) == 0 {
+		return nil, fmt.Errorf("a secret needs at least one attribute")
+	}
+
+	return doc, nil
+}
+
+func (a *DocumentAttribute) check() error {
+	if a.Name == "" || strings.Contains(a.Name, ":") {
+		return fmt.Errorf("invalid attribute name '%s'", a.Name)
+	}
+	if a.Type != "" && !IsValidAttributeType(a.Type) {
+		return fmt.Errorf("attribute '%s' has unknown type '%s'", a.Name, a.Type)
+	}
+
+	given := 0
+	for _, s := range []string{a.Value, a.Reference, a.File} {
+		if s != "" {
+			given++
+		}
+	}
+	if given > 1 {
+		return fmt.Errorf("attribute '%s' can only have one of value, ref and file", a.Name)
+	}
+
+	if a.File != "" && a.File != DocumentKeepFile && !strings.HasPrefix(a.File, "@") {
+		return fmt.Errorf("file attribute '%s' should be '%s' or '@/path/to/file'", a.Name, DocumentKeepFile)
+	}
+	if a.Reference != "" {
+		if _, _, err := ParseReference(a.Reference); err != nil {
+			return fmt.Errorf("attribute '%s': %s", a.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Apply returns the secret described by the document. Attributes whose
+// content did not change are kept along with their history, the others
+// archive their previous value. The names of the attributes that were added
+// or changed are returned.
+func (d *SecretDocument) Apply(meta *SecretMeta, attrs AttributeMap, now time.Time, historySize int) (*SecretMeta, AttributeMap, []string, error) {
+	nextMeta := *meta
+	nextMeta.Tags = nil
+	nextMeta.Notes = d.Notes
+	nextMeta.Expires = ""
+	if err := nextMeta.AddTags(d.Tags); err != nil {
+		return nil, nil, nil, err
+	}
+	if d.Expires != "" {
+		expires, err := ParseExpiry(d.Expires, now)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid expiration date for the secret: %s", err)
+		}
+		nextMeta.Expires = expires
+	}
+
+	nextAttrs := make(AttributeMap)
+	edited := make([]string, 0)
+
+	for _, doc := range d.Attributes {
+		existing := attrs[doc.Name]
+		attr := &Attribute{
+			Value:     doc.Value,
+			Reference: doc.Reference,
+			Type:      doc.Type,
+			EyesOnly:  doc.EyesOnly,
+		}
+
+		switch {
+		case doc.File == DocumentKeepFile:
+			if existing == nil || !existing.File {
+				return nil, nil, nil, fmt.Errorf("attribute '%s' has no file content to keep", doc.Name)
+			}
+			attr.Value = existing.Value
+			attr.File = true
+		case doc.File != "":
+			content, err := ioutil.ReadFile(doc.File[1:])
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("could not open file %s: %s", doc.File[1:], err)
+			}
+			attr.Value = base64.StdEncoding.EncodeToString(content)
+			attr.File = true
+			if attr.Type == "" {
+				attr.Type = AttributeFile
+			}
+		}
+
+		if doc.Expires != "" {
+			expires, err := ParseExpiry(doc.Expires, now)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("invalid expiration date for attribute '%s': %s", doc.Name, err)
+			}
+			attr.Expires = expires
+		}
+
+		switch {
+		case existing == nil:
+			edited = append(edited, doc.Name)
+		case existing.Value == attr.Value && existing.File == attr.File && existing.Reference == attr.Reference:
+			// Same content, only its flags may have changed
+			if existing.Type != attr.Type {
+				edited = append(edited, doc.Name)
+			}
+			existing.Type = attr.Type
+			existing.EyesOnly = attr.EyesOnly
+			existing.Expires = attr.Expires
+			attr = existing
+		default:
+			existing.Replace(attr, historySize)
+			edited = append(edited, doc.Name)
+		}
+
+		nextAttrs.Add(doc.Name, attr)
+	}
+
+	return &nextMeta, nextAttrs, edited, nil
+}
@@ -0,0 +1,123 @@
+package util
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func documentSecret() (*SecretMeta, AttributeMap) {
+	meta := &SecretMeta{Created: 1500000000, Tags: []string{"web"}, Notes: "Main account"}
+
+	attrs := AttributeMap{}
+	attrs.Add("username", &Attribute{Value: "apognu"})
+	attrs.Add("password", &Attribute{Value: "hunter2", EyesOnly: true, Type: AttributePassword, Generator: &GeneratorParams{Kind: "password", Length: 7}})
+	attrs.Add("enabled", &Attribute{Value: "yes"})
+	attrs.Add("notes", &Attribute{Value: "first line\nsecond line", Type: AttributeNote})
+	attrs.Add("key", &Attribute{Value: base64.StdEncoding.EncodeToString([]byte("content")), File: true, Type: AttributeFile})
+	attrs.Add("shared", &Attribute{Reference: "infra/db#password"})
+	attrs.Add("token", &Attribute{Value: "abc", Expires: "2018-01-01"})
+
+	return meta, attrs
+}
+
+func TestSecretDocumentRoundTrip(t *testing.T) {
+	meta, attrs := documentSecret()
+
+	data, err := MarshalSecretDocument("website.com", meta, attrs)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "# Secret 'website.com'"))
+
+	doc, err := ParseSecretDocument(data)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"web"}, doc.Tags)
+	assert.Equal(t, "Main account", doc.Notes)
+
+	names := make([]string, 0)
+	for _, attr := range doc.Attributes {
+		names = append(names, attr.Name)
+	}
+	assert.Equal(t, attrs.Keys(), names, "attributes should keep their order")
+
+	nextMeta, nextAttrs, edited, err := doc.Apply(meta, attrs, time.Now(), 10)
+	assert.Nil(t, err)
+	assert.Empty(t, edited, "an untouched document should not change anything")
+	assert.Equal(t, meta, nextMeta)
+	for _, k := range attrs.Keys() {
+		assert.Equal(t, attrs[k], nextAttrs[k], k)
+	}
+	assert.Equal(t, "yes", nextAttrs["enabled"].Value, "YAML booleans should be read as text")
+	assert.Equal(t, "2018-01-01", nextAttrs["token"].Expires, "YAML dates should be read as text")
+	assert.NotNil(t, nextAttrs["password"].Generator, "unchanged attributes should be kept as they are")
+}
+
+func TestSecretDocumentChanges(t *testing.T) {
+	meta, attrs := documentSecret()
+
+	file, err := ioutil.TempFile("", "vault-document")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	file.WriteString("new content")
+	file.Close()
+
+	doc, err := ParseSecretDocument([]byte(`
+tags: [web, personal]
+attributes:
+  password:
+    value: hunter3
+    eyes-only: true
+  username: apognu
+  key:
+    file: "@` + file.Name() + `"
+  url:
+    value: https://example.com
+    type: url
+  shared:
+    ref: infra/db#password
+    eyes-only: true
+`))
+	assert.Nil(t, err)
+
+	nextMeta, nextAttrs, edited, err := doc.Apply(meta, attrs, time.Now(), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"personal", "web"}, nextMeta.Tags)
+	assert.Equal(t, "", nextMeta.Notes)
+	assert.Equal(t, []string{"password", "key", "url"}, edited)
+	assert.Equal(t, []string{"password", "username", "key", "url", "shared"}, nextAttrs.Keys())
+
+	assert.Equal(t, "hunter3", nextAttrs["password"].Value)
+	assert.Equal(t, "hunter2", nextAttrs["password"].History[0].Value, "changed values should be archived")
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("new content")), nextAttrs["key"].Value)
+	assert.True(t, nextAttrs["key"].File)
+	assert.True(t, nextAttrs["shared"].EyesOnly)
+	assert.Nil(t, nextAttrs["enabled"], "removed attributes should be deleted")
+}
+
+func TestInvalidSecretDocuments(t *testing.T) {
+	invalid := []string{
+		"attributes: {}",
+		"attributes: [a, b]",
+		"attributes:\n  a: 1\n  a: 2",
+		"attributes:\n  a:\n    value: x\n    ref: other#a",
+		"attributes:\n  a:\n    type: unknown",
+		"attributes:\n  a:\n    file: /etc/passwd",
+		"attributes:\n  a:\n    ref: ../etc#password",
+		"attributes:\n  'a:url': x",
+	}
+
+	for _, data := range invalid {
+		_, err := ParseSecretDocument([]byte(data))
+		assert.NotNil(t, err, "'%s' should be rejected", data)
+	}
+
+	_, attrs := documentSecret()
+	doc, err := ParseSecretDocument([]byte("attributes:\n  username:\n    file: keep"))
+	assert.Nil(t, err)
+	_, _, _, err = doc.Apply(&SecretMeta{}, attrs, time.Now(), 10)
+	assert.NotNil(t, err, "only file attributes can keep their content")
+}
@@ -0,0 +1,100 @@
+package util
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expiry is a secret, or an attribute of a secret, with an expiration date.
+// Days is negative for expired ones.
+type Expiry struct {
+	Path      string `json:"path"`
+	Attribute string `json:"attribute,omitempty"`
+	Expires   string `json:"expires"`
+	Days      int    `json:"days"`
+}
+
+// ParseDuration parses durations such as 30m or 8h, as well as days and
+// weeks, written as 30d or 2w.
+func ParseDuration(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if !strings.HasSuffix(s, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(s, suffix))
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration '%s'", s)
+		}
+		return time.Duration(n) * unit, nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+// ParseExpiry reads an expiration date, given either as a date or as a
+// duration from now such as 90d.
+func ParseExpiry(value string, now time.Time) (string, error) {
+	if _, err := time.Parse(DateFormat, value); err == nil {
+		return value, nil
+	}
+
+	d, err := ParseDuration(value)
+	if err != nil {
+		return "", fmt.Errorf("'%s' is neither a date formatted as YYYY-MM-DD nor a duration such as 90d", value)
+	}
+
+	return now.Add(d).Format(DateFormat), nil
+}
+
+// DaysUntil returns the number of calendar days between now and a date.
+func DaysUntil(date string, now time.Time) (int, error) {
+	t, err := time.ParseInLocation(DateFormat, date, now.Location())
+	if err != nil {
+		return 0, err
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	// Round to absorb daylight saving time changes
+	return int(math.Floor((t.Sub(today).Hours() + 12) / 24)), nil
+}
+
+// SecretExpiries lists the expiration dates of a secret and its attributes
+// falling before now plus the given duration, soonest first.
+func SecretExpiries(path string, meta *SecretMeta, attrs AttributeMap, now time.Time, within time.Duration) []Expiry {
+	expiries := make([]Expiry, 0)
+
+	add := func(attribute, date string) {
+		days, err := DaysUntil(date, now)
+		if err != nil || time.Duration(days)*24*time.Hour > within {
+			return
+		}
+		expiries = append(expiries, Expiry{Path: path, Attribute: attribute, Expires: date, Days: days})
+	}
+
+	if meta.Expires != "" {
+		add("", meta.Expires)
+	}
+	for _, k := range attrs.Keys() {
+		if attrs[k].Expires != "" {
+			add(k, attrs[k].Expires)
+		}
+	}
+
+	SortExpiries(expiries)
+
+	return expiries
+}
+
+func SortExpiries(expiries []Expiry) {
+	sort.SliceStable(expiries, func(i, j int) bool {
+		if expiries[i].Days != expiries[j].Days {
+			return expiries[i].Days < expiries[j].Days
+		}
+		return expiries[i].Path < expiries[j].Path
+	})
+}
@@ -0,0 +1,73 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDuration(t *testing.T) {
+	d, err := ParseDuration("30d")
+	assert.Nil(t, err)
+	assert.Equal(t, 30*24*time.Hour, d)
+
+	d, err = ParseDuration("2w")
+	assert.Nil(t, err)
+	assert.Equal(t, 14*24*time.Hour, d)
+
+	d, err = ParseDuration("8h")
+	assert.Nil(t, err)
+	assert.Equal(t, 8*time.Hour, d)
+
+	_, err = ParseDuration("-3d")
+	assert.NotNil(t, err)
+	_, err = ParseDuration("soon")
+	assert.NotNil(t, err)
+}
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Date(2017, 10, 10, 15, 0, 0, 0, time.UTC)
+
+	date, err := ParseExpiry("2018-01-31", now)
+	assert.Nil(t, err)
+	assert.Equal(t, "2018-01-31", date)
+
+	date, err = ParseExpiry("90d", now)
+	assert.Nil(t, err)
+	assert.Equal(t, "2018-01-08", date)
+
+	_, err = ParseExpiry("2018-31-01", now)
+	assert.NotNil(t, err)
+}
+
+func TestDaysUntil(t *testing.T) {
+	now := time.Date(2017, 10, 10, 23, 30, 0, 0, time.UTC)
+
+	days, _ := DaysUntil("2017-10-10", now)
+	assert.Equal(t, 0, days)
+	days, _ = DaysUntil("2017-10-11", now)
+	assert.Equal(t, 1, days, "tomorrow should be one day away whatever the time")
+	days, _ = DaysUntil("2017-10-01", now)
+	assert.Equal(t, -9, days)
+}
+
+func TestSecretExpiries(t *testing.T) {
+	now := time.Date(2017, 10, 10, 12, 0, 0, 0, time.UTC)
+	meta := &SecretMeta{Expires: "2017-11-30"}
+	attrs := AttributeMap{
+		"token":    &Attribute{Value: "abc", Expires: "2017-10-20", Position: 1},
+		"old":      &Attribute{Value: "def", Expires: "2017-10-01", Position: 2},
+		"password": &Attribute{Value: "ghi", Position: 3},
+	}
+
+	expiries := SecretExpiries("api", meta, attrs, now, 30*24*time.Hour)
+	assert.Equal(t, []Expiry{
+		{Path: "api", Attribute: "old", Expires: "2017-10-01", Days: -9},
+		{Path: "api", Attribute: "token", Expires: "2017-10-20", Days: 10},
+	}, expiries, "expired attributes should come first, later dates should be left out")
+
+	expiries = SecretExpiries("api", meta, attrs, now, 60*24*time.Hour)
+	assert.Equal(t, 3, len(expiries))
+	assert.Equal(t, "", expiries[2].Attribute, "the secret itself should be listed")
+}
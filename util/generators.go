@@ -0,0 +1,272 @@
+package util
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	GeneratorPassword = "password"
+
+	// PublicSuffix is appended to the name of a generated attribute to name
+	// the attribute holding the public half of a key pair.
+	PublicSuffix = "_pub"
+)
+
+var (
+	basicChars  = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
+	symbolChars = []rune(`!"#$%&'()*+,-./:;<=>?@[\]^_{|}~`)
+
+	generatorRegex = regexp.MustCompile(`^([a-z][a-z0-9-]*)(?::([0-9]+))?$`)
+)
+
+// Generator produces random values of one kind. Generators of key pairs also
+// return the public half of the pair.
+type Generator struct {
+	Description string
+	// Length is the default size of generated values, in the unit of the
+	// kind. Passwords use the configured length instead.
+	Length int
+	// Sized tells whether the size of generated values can be chosen
+	Sized bool
+	// Type is the attribute type of generated values, and PublicType the one
+	// of the public half of key pairs
+	Type       string
+	PublicType string
+	// Secret tells whether generated values are eyes-only. The public half
+	// of a key pair never is.
+	Secret   bool
+	KeyPair  bool
+	Generate func(length int, symbols bool) ([]byte, []byte, error)
+}
+
+var Generators = map[string]*Generator{
+	GeneratorPassword: {
+		Description: "alphanumeric password of N characters",
+		Sized:       true,
+		Secret:      true,
+		Generate: func(length int, symbols bool) ([]byte, []byte, error) {
+			password, err := GeneratePassword(length, symbols)
+			return []byte(password), nil, err
+		},
+	},
+	"hex": {
+		Description: "N random bytes, hex-encoded",
+		Length:      32,
+		Sized:       true,
+		Secret:      true,
+		Generate: func(length int, _ bool) ([]byte, []byte, error) {
+			data, err := randomBytes(length)
+			return []byte(hex.EncodeToString(data)), nil, err
+		},
+	},
+	"base64": {
+		Description: "N random bytes, base64-encoded",
+		Length:      32,
+		Sized:       true,
+		Secret:      true,
+		Generate: func(length int, _ bool) ([]byte, []byte, error) {
+			data, err := randomBytes(length)
+			return []byte(base64.StdEncoding.EncodeToString(data)), nil, err
+		},
+	},
+	"uuid": {
+		Description: "random UUID",
+		Generate: func(int, bool) ([]byte, []byte, error) {
+			id, err := uuid.NewRandom()
+			return []byte(id.String()), nil, err
+		},
+	},
+	"jwt": {
+		Description: "HMAC key of N bytes to sign JWTs, base64url-encoded",
+		Length:      64,
+		Sized:       true,
+		Secret:      true,
+		Generate: func(length int, _ bool) ([]byte, []byte, error) {
+			data, err := randomBytes(length)
+			return []byte(base64.RawURLEncoding.EncodeToString(data)), nil, err
+		},
+	},
+	"wireguard": {
+		Description: "WireGuard key pair",
+		Secret:      true,
+		KeyPair:     true,
+		Generate:    generateWireGuardKey,
+	},
+	"ssh-ed25519": {
+		Description: "Ed25519 SSH key pair",
+		Type:        AttributePEM,
+		PublicType:  AttributeFile,
+		Secret:      true,
+		KeyPair:     true,
+		Generate: func(int, bool) ([]byte, []byte, error) {
+			return GenerateSSHKey(SSHKeyEd25519, 0, "")
+		},
+	},
+	"ssh-rsa": {
+		Description: "RSA SSH key pair of N bits",
+		Length:      4096,
+		Sized:       true,
+		Type:        AttributePEM,
+		PublicType:  AttributeFile,
+		Secret:      true,
+		KeyPair:     true,
+		Generate: func(length int, _ bool) ([]byte, []byte, error) {
+			return GenerateSSHKey(SSHKeyRSA, length, "")
+		},
+	},
+}
+
+// GeneratorParams records how the value of an attribute was generated, so
+// it can be generated again the same way.
+type GeneratorParams struct {
+	Kind    string `json:"kind"`
+	Length  int    `json:"length,omitempty"`
+	Symbols bool   `json:"symbols,omitempty"`
+	// Public is the attribute holding the public half of a key pair
+	Public    string `json:"public,omitempty"`
+	Generated int64  `json:"generated"`
+}
+
+// GeneratedBefore tells whether the value of an attribute was generated
+// before the given time. Attributes that were not generated never are.
+func (a *Attribute) GeneratedBefore(t time.Time) bool {
+	return a.Generator != nil && a.Generator.Generated < t.Unix()
+}
+
+// GeneratorKinds returns the names of all generators, sorted.
+func GeneratorKinds() []string {
+	kinds := make([]string, 0, len(Generators))
+	for kind := range Generators {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	return kinds
+}
+
+// GetGenerator returns the generator of a kind, passwords being the default.
+func GetGenerator(kind string) (*Generator, error) {
+	if kind == "" {
+		kind = GeneratorPassword
+	}
+
+	generator, ok := Generators[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown generator '%s'", kind)
+	}
+
+	return generator, nil
+}
+
+// ParseGenerator reads a kind of generated value given as 'kind' or
+// 'kind:length'. An empty string stands for a password.
+func ParseGenerator(s string) (string, int, error) {
+	if s == "" {
+		return "", 0, nil
+	}
+
+	matches := generatorRegex.FindStringSubmatch(s)
+	if matches == nil {
+		return "", 0, fmt.Errorf("invalid generator '%s', expected kind or kind:length", s)
+	}
+
+	generator, err := GetGenerator(matches[1])
+	if err != nil {
+		return "", 0, err
+	}
+
+	length := 0
+	if matches[2] != "" {
+		if !generator.Sized {
+			return "", 0, fmt.Errorf("generator '%s' does not take a length", matches[1])
+		}
+		if length, err = strconv.Atoi(matches[2]); err != nil || length == 0 {
+			return "", 0, fmt.Errorf("invalid length in generator '%s'", s)
+		}
+	}
+
+	return matches[1], length, nil
+}
+
+// IsGenerator tells whether a string names a generator, optionally with a
+// length.
+func IsGenerator(s string) bool {
+	_, _, err := ParseGenerator(s)
+	return s != "" && err == nil
+}
+
+// GeneratePassword returns a random password of the given length. A quarter
+// of its characters are symbols if asked to.
+func GeneratePassword(length int, symbols bool) (string, error) {
+	password := make([]rune, length)
+	for i := range password {
+		chars := basicChars
+		if symbols {
+			n, err := randomIndex(4)
+			if err != nil {
+				return "", err
+			}
+			if n < 1 {
+				chars = symbolChars
+			}
+		}
+
+		n, err := randomIndex(len(chars))
+		if err != nil {
+			return "", err
+		}
+		password[i] = chars[n]
+	}
+
+	return string(password), nil
+}
+
+// randomIndex returns a uniformly distributed random number below n, which
+// must not exceed 256. Bytes that would bias the result are drawn again.
+func randomIndex(n int) (int, error) {
+	limit := 256 - 256%n
+	for {
+		data, err := randomBytes(1)
+		if err != nil {
+			return 0, err
+		}
+		if int(data[0]) < limit {
+			return int(data[0]) % n, nil
+		}
+	}
+}
+
+func randomBytes(length int) ([]byte, error) {
+	data := make([]byte, length)
+	if _, err := rand.Read(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// generateWireGuardKey generates a Curve25519 key pair, both halves encoded
+// the way wg genkey and wg pubkey print them.
+func generateWireGuardKey(int, bool) ([]byte, []byte, error) {
+	var private, public [32]byte
+	if _, err := rand.Read(private[:]); err != nil {
+		return nil, nil, err
+	}
+
+	// Clamp the private key as curve25519 expects it
+	private[0] &= 248
+	private[31] = (private[31] & 127) | 64
+
+	curve25519.ScalarBaseMult(&public, &private)
+
+	return []byte(base64.StdEncoding.EncodeToString(private[:])), []byte(base64.StdEncoding.EncodeToString(public[:])), nil
+}
@@ -0,0 +1,116 @@
+package util
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/curve25519"
+)
+
+func TestGenerators(t *testing.T) {
+	for _, kind := range GeneratorKinds() {
+		generator, err := GetGenerator(kind)
+		assert.Nil(t, err)
+
+		length := generator.Length
+		if length == 0 {
+			length = 16
+		}
+
+		value, public, err := generator.Generate(length, false)
+		assert.Nil(t, err, kind)
+		assert.NotEmpty(t, value, kind)
+		assert.Equal(t, generator.KeyPair, public != nil, kind)
+	}
+
+	_, err := GetGenerator("dsa")
+	assert.NotNil(t, err)
+	generator, err := GetGenerator("")
+	assert.Nil(t, err)
+	assert.Equal(t, Generators[GeneratorPassword], generator)
+}
+
+func TestGeneratedValues(t *testing.T) {
+	value, _, _ := Generators["hex"].Generate(16, false)
+	data, err := hex.DecodeString(string(value))
+	assert.Nil(t, err)
+	assert.Equal(t, 16, len(data))
+
+	value, _, _ = Generators["base64"].Generate(24, false)
+	data, err = base64.StdEncoding.DecodeString(string(value))
+	assert.Nil(t, err)
+	assert.Equal(t, 24, len(data))
+
+	value, _, _ = Generators["jwt"].Generate(64, false)
+	data, err = base64.RawURLEncoding.DecodeString(string(value))
+	assert.Nil(t, err)
+	assert.Equal(t, 64, len(data))
+
+	value, _, _ = Generators["uuid"].Generate(0, false)
+	assert.Regexp(t, regexp.MustCompile("^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$"), string(value))
+
+	value, _, _ = Generators[GeneratorPassword].Generate(20, false)
+	assert.Regexp(t, regexp.MustCompile("^[a-zA-Z0-9]{20}$"), string(value))
+}
+
+func TestGeneratePassword(t *testing.T) {
+	password, err := GeneratePassword(200, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, len([]rune(password)))
+	assert.True(t, strings.ContainsAny(password, string(symbolChars)), "password should contain symbols")
+	assert.True(t, strings.ContainsAny(password, string(basicChars)), "password should contain letters and digits")
+
+	seen := make(map[rune]bool)
+	for _, c := range symbolChars {
+		assert.False(t, seen[c], "symbol '%c' should only be drawn from once", c)
+		seen[c] = true
+	}
+
+	for _, n := range []int{1, 4, len(basicChars), len(symbolChars)} {
+		for i := 0; i < 100; i++ {
+			idx, err := randomIndex(n)
+			assert.Nil(t, err)
+			assert.True(t, idx >= 0 && idx < n)
+		}
+	}
+}
+
+func TestWireGuardKey(t *testing.T) {
+	private, public, err := Generators["wireguard"].Generate(0, false)
+	assert.Nil(t, err)
+
+	var privateKey, publicKey, expected [32]byte
+	data, err := base64.StdEncoding.DecodeString(string(private))
+	assert.Nil(t, err)
+	copy(privateKey[:], data)
+	data, err = base64.StdEncoding.DecodeString(string(public))
+	assert.Nil(t, err)
+	copy(publicKey[:], data)
+
+	assert.Equal(t, byte(0), privateKey[0]&7, "private key should be clamped")
+	assert.Equal(t, byte(64), privateKey[31]&192, "private key should be clamped")
+
+	curve25519.ScalarBaseMult(&expected, &privateKey)
+	assert.Equal(t, expected, publicKey)
+}
+
+func TestParseGenerator(t *testing.T) {
+	kind, length, err := ParseGenerator("base64:48")
+	assert.Nil(t, err)
+	assert.Equal(t, "base64", kind)
+	assert.Equal(t, 48, length)
+
+	kind, length, err = ParseGenerator("")
+	assert.Nil(t, err)
+	assert.Equal(t, "", kind)
+	assert.Equal(t, 0, length)
+
+	for _, invalid := range []string{"HEX", "hex:", "hex:-1", "unknown", "wireguard:32"} {
+		_, _, err := ParseGenerator(invalid)
+		assert.NotNil(t, err, "'%s' should be rejected", invalid)
+	}
+}
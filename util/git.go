@@ -36,8 +36,10 @@ func GitInit() {
 }
 
 func GitRemote(url string) {
-	RunGitCommand(true, "remote", "rm", "origin")
-	RunGitCommand(false, "remote", "add", "-f", "origin", url)
+	remote := ConfigString("git.remote")
+
+	RunGitCommand(true, "remote", "rm", remote)
+	RunGitCommand(false, "remote", "add", "-f", remote, url)
 }
 
 func GitCommit(file string, op int, message string) {
@@ -52,14 +54,27 @@ func GitCommit(file string, op int, message string) {
 		}
 	}
 
+	if file != "-A" {
+		file = EscapePath(file)
+	}
+
 	RunGitCommand(true, "add", file)
 	RunGitCommand(true, "commit", "-m", message)
+
+	gitAutoPush()
 }
 
-func GitCommitRename(oldFile, newFile string) {
-	RunGitCommand(true, "add", oldFile)
-	RunGitCommand(true, "add", newFile)
+// GitCommitRename records a renamed secret, along with the other files that
+// were changed by the renaming.
+func GitCommitRename(oldFile, newFile string, related ...string) {
+	RunGitCommand(true, "add", EscapePath(oldFile))
+	RunGitCommand(true, "add", EscapePath(newFile))
+	for _, file := range related {
+		RunGitCommand(true, "add", EscapePath(file))
+	}
 	RunGitCommand(true, "commit", "-m", fmt.Sprintf("Renamed '%s' to '%s'", oldFile, newFile))
+
+	gitAutoPush()
 }
 
 func GitPush() {
@@ -67,13 +82,25 @@ func GitPush() {
 
 	RunGitCommand(false, "add", "-A")
 	RunGitCommand(false, "commit", "-m", "Vault store update.")
-	RunGitCommand(false, "push", "-u", "origin", "master")
+	RunGitCommand(false, "push", "-u", ConfigString("git.remote"), ConfigString("git.branch"))
 }
 
 func GitPull() {
 	logrus.Info("pulling from remote repository")
 
-	RunGitCommand(false, "pull", "origin", "master")
+	RunGitCommand(false, "pull", ConfigString("git.remote"), ConfigString("git.branch"))
+}
+
+func gitAutoPush() {
+	if !ConfigBool("git.autopush") {
+		return
+	}
+
+	logrus.Info("pushing to remote repository")
+
+	if err := RunGitCommand(false, "push", "-u", ConfigString("git.remote"), ConfigString("git.branch")); err != nil {
+		logrus.Warnf("could not push to remote repository: %s", err)
+	}
 }
 
 func RunGitCommand(suppress bool, args ...string) error {
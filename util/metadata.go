@@ -0,0 +1,71 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SecretMeta describes a secret. It is encrypted along with the secret, so
+// none of it appears in file names or commit messages.
+type SecretMeta struct {
+	Created int64    `json:"created,omitempty"`
+	Updated int64    `json:"updated,omitempty"`
+	Notes   string   `json:"notes,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+
+	// Author is the fingerprint of the key slot the secret was last
+	// updated with
+	Author string `json:"author,omitempty"`
+
+	// Template is the name of the template the secret was created from
+	Template string `json:"template,omitempty"`
+	// Expires is the date, formatted as YYYY-MM-DD, the secret expires on
+	Expires string `json:"expires,omitempty"`
+}
+
+// Touch records a modification of the secret at the given time with the
+// given key slot, and its creation if it was not recorded yet.
+func (m *SecretMeta) Touch(t time.Time, slot string) {
+	if m.Created == 0 {
+		m.Created = t.Unix()
+	}
+	m.Updated = t.Unix()
+	m.Author = slot
+}
+
+func (m *SecretMeta) HasTag(tag string) bool {
+	return StringArrayContains(m.Tags, tag)
+}
+
+// AddTags adds tags to the secret, ignoring the ones it already has. Tags are
+// kept sorted.
+func (m *SecretMeta) AddTags(tags []string) error {
+	for _, tag := range tags {
+		if !IsValidTag(tag) {
+			return fmt.Errorf("invalid tag '%s'", tag)
+		}
+		if !m.HasTag(tag) {
+			m.Tags = append(m.Tags, tag)
+		}
+	}
+	sort.Strings(m.Tags)
+
+	return nil
+}
+
+func (m *SecretMeta) RemoveTags(tags []string) {
+	for _, tag := range tags {
+		m.Tags = RemoveFromSlice(m.Tags, tag)
+	}
+	if len(m.Tags) == 0 {
+		m.Tags = nil
+	}
+}
+
+// IsValidTag checks that a tag is a single word, so tags can be given as
+// comma-separated lists.
+func IsValidTag(tag string) bool {
+	return tag != "" && !strings.ContainsAny(tag, ", \t\n")
+}
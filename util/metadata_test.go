@@ -0,0 +1,38 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretMetaTouch(t *testing.T) {
+	meta := &SecretMeta{}
+	created := time.Unix(1500000000, 0)
+
+	meta.Touch(created, "721a9b52bfceacc503c056e3b9b93cfa")
+	assert.Equal(t, created.Unix(), meta.Created)
+	assert.Equal(t, created.Unix(), meta.Updated)
+	assert.Equal(t, "721a9b52bfceacc503c056e3b9b93cfa", meta.Author)
+
+	meta.Touch(created.Add(time.Hour), "5d41402abc4b2a76b9719d911017c592")
+	assert.Equal(t, created.Unix(), meta.Created, "creation time should not change")
+	assert.Equal(t, created.Add(time.Hour).Unix(), meta.Updated)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", meta.Author, "author should be the last key slot used")
+}
+
+func TestSecretMetaTags(t *testing.T) {
+	meta := &SecretMeta{}
+
+	assert.Nil(t, meta.AddTags([]string{"web", "prod", "web"}))
+	assert.Equal(t, []string{"prod", "web"}, meta.Tags)
+	assert.True(t, meta.HasTag("prod"))
+	assert.False(t, meta.HasTag("staging"))
+
+	assert.NotNil(t, meta.AddTags([]string{"two words"}))
+	assert.NotNil(t, meta.AddTags([]string{""}))
+
+	meta.RemoveTags([]string{"prod", "web"})
+	assert.Nil(t, meta.Tags)
+}
@@ -0,0 +1,299 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Output formats selected with -o, besides the default text output
+const (
+	OutputText   = "text"
+	OutputJSON   = "json"
+	OutputYAML   = "yaml"
+	OutputEnv    = "env"
+	OutputDotenv = "dotenv"
+	OutputPaths  = "paths"
+)
+
+var (
+	SecretOutputs = []string{OutputText, OutputJSON, OutputYAML, OutputEnv, OutputDotenv}
+	ListOutputs   = []string{OutputText, OutputJSON, OutputPaths}
+	ReportOutputs = []string{OutputText, OutputJSON}
+
+	envNameRegex = regexp.MustCompile("[^A-Z0-9_]")
+)
+
+// SecretView is a secret as presented to the user, eyes-only values being
+// redacted unless asked otherwise. File contents are base64-encoded.
+type SecretView struct {
+	Path       string          `json:"path" yaml:"path"`
+	Attributes []AttributeView `json:"attributes" yaml:"attributes"`
+	Tags       []string        `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Notes      string          `json:"notes,omitempty" yaml:"notes,omitempty"`
+	Expires    string          `json:"expires,omitempty" yaml:"expires,omitempty"`
+	Template   string          `json:"template,omitempty" yaml:"template,omitempty"`
+	Author     string          `json:"author,omitempty" yaml:"author,omitempty"`
+	Created    string          `json:"created,omitempty" yaml:"created,omitempty"`
+	Updated    string          `json:"updated,omitempty" yaml:"updated,omitempty"`
+}
+
+// AttributeView is an attribute of a SecretView. Reference is the attribute
+// the value was read from, or the one that could not be read if Unresolved
+// is set. Certificates and SSH keys held in the value are described as well.
+type AttributeView struct {
+	Name         string        `json:"name" yaml:"name"`
+	Value        string        `json:"value" yaml:"value"`
+	Type         string        `json:"type" yaml:"type"`
+	EyesOnly     bool          `json:"eyes_only" yaml:"eyes_only"`
+	File         bool          `json:"file,omitempty" yaml:"file,omitempty"`
+	Redacted     bool          `json:"redacted,omitempty" yaml:"redacted,omitempty"`
+	Reference    string        `json:"reference,omitempty" yaml:"reference,omitempty"`
+	Unresolved   bool          `json:"unresolved,omitempty" yaml:"unresolved,omitempty"`
+	Expires      string        `json:"expires,omitempty" yaml:"expires,omitempty"`
+	Pending      *PendingView  `json:"pending,omitempty" yaml:"pending,omitempty"`
+	Certificates []Certificate `json:"certificates,omitempty" yaml:"certificates,omitempty"`
+	SSHKeys      []SSHKeyView  `json:"ssh_keys,omitempty" yaml:"ssh_keys,omitempty"`
+}
+
+// PendingView is the new value waiting to be confirmed for an attribute,
+// redacted like the attribute itself.
+type PendingView struct {
+	Value    string `json:"value" yaml:"value"`
+	Redacted bool   `json:"redacted,omitempty" yaml:"redacted,omitempty"`
+}
+
+// SSHKeyView describes an SSH key held in an attribute. Key is the public
+// key as an authorized_keys line, only given for public keys.
+type SSHKeyView struct {
+	Key         string `json:"key,omitempty" yaml:"key,omitempty"`
+	Fingerprint string `json:"fingerprint" yaml:"fingerprint"`
+	Private     bool   `json:"private,omitempty" yaml:"private,omitempty"`
+}
+
+// DirectoryEntry is a secret, alias or directory of the tree printed by
+// vault list. Level is the depth of the entry below the listed directory.
+type DirectoryEntry struct {
+	Path   string `json:"path"`
+	Name   string `json:"-"`
+	Level  int    `json:"-"`
+	Dir    bool   `json:"-"`
+	Target string `json:"alias,omitempty"`
+}
+
+// DescribeSecret returns the view of a secret whose references were
+// resolved. Eyes-only values are only included if print is set.
+func DescribeSecret(path string, meta *SecretMeta, attrs AttributeMap, print bool) SecretView {
+	view := SecretView{
+		Path:       path,
+		Attributes: make([]AttributeView, 0, len(attrs)),
+		Tags:       meta.Tags,
+		Notes:      meta.Notes,
+		Expires:    meta.Expires,
+		Template:   meta.Template,
+		Author:     meta.Author,
+	}
+	if meta.Created != 0 {
+		view.Created = time.Unix(meta.Created, 0).Format(time.RFC3339)
+	}
+	if meta.Updated != 0 {
+		view.Updated = time.Unix(meta.Updated, 0).Format(time.RFC3339)
+	}
+
+	for _, k := range attrs.Keys() {
+		attr := attrs[k]
+		av := AttributeView{
+			Name:      k,
+			Value:     attr.Value,
+			Type:      attr.GetType(),
+			EyesOnly:  attr.EyesOnly,
+			File:      attr.File,
+			Reference: attr.ResolvedFrom,
+			Expires:   attr.Expires,
+		}
+
+		switch {
+		case attr.Reference != "":
+			// References are only left in place when they could not be resolved
+			av.Value = ""
+			av.Reference = attr.Reference
+			av.Unresolved = true
+		case attr.EyesOnly && !print:
+			av.Value = ""
+			av.Redacted = true
+		}
+
+		if attr.Pending != nil {
+			av.Pending = &PendingView{Value: attr.Pending.Value}
+			if av.Redacted {
+				av.Pending.Value = ""
+				av.Pending.Redacted = true
+			}
+		}
+		for _, cert := range ParseCertificates(attr) {
+			av.Certificates = append(av.Certificates, DescribeCertificate(path, k, cert, attrs))
+		}
+		for _, key := range ParseSSHKeys(k, attr) {
+			kv := SSHKeyView{Fingerprint: key.Fingerprint(), Private: key.Private}
+			if !key.Private {
+				kv.Key = key.AuthorizedKey()
+			}
+			av.SSHKeys = append(av.SSHKeys, kv)
+		}
+
+		view.Attributes = append(view.Attributes, av)
+	}
+
+	return view
+}
+
+// MarshalSecret renders the view of a secret in one of the structured output
+// formats. Environment formats only hold attribute values, and leave out the
+// attributes that are redacted or unresolved.
+func MarshalSecret(view SecretView, format string) ([]byte, error) {
+	switch format {
+	case OutputJSON:
+		return MarshalJSON(view)
+
+	case OutputYAML:
+		return yaml.Marshal(view)
+
+	case OutputEnv, OutputDotenv:
+		var buf bytes.Buffer
+		names := make(map[string]string)
+
+		for _, attr := range view.Attributes {
+			if attr.Redacted || attr.Unresolved {
+				continue
+			}
+
+			name := EnvName(attr.Name)
+			if other, ok := names[name]; ok {
+				return nil, fmt.Errorf("attributes '%s' and '%s' would both be exported as %s", other, attr.Name, name)
+			}
+			names[name] = attr.Name
+
+			if format == OutputEnv {
+				fmt.Fprintf(&buf, "export %s=%s\n", name, shellQuote(attr.Value))
+			} else {
+				fmt.Fprintf(&buf, "%s=%s\n", name, dotenvQuote(attr.Value))
+			}
+		}
+
+		return buf.Bytes(), nil
+	}
+
+	return nil, fmt.Errorf("unknown output format '%s'", format)
+}
+
+// MarshalJSON renders data as indented JSON, as printed by every command
+// supporting -o json.
+func MarshalJSON(v interface{}) ([]byte, error) {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, '\n'), nil
+}
+
+// EnvName returns the name of the environment variable an attribute is
+// exported as: in upper case, every other character than letters and digits
+// replaced with an underscore.
+func EnvName(name string) string {
+	name = envNameRegex.ReplaceAllString(strings.ToUpper(name), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// shellQuote quotes a value for a POSIX shell, which does not interpret
+// anything between single quotes.
+func shellQuote(value string) string {
+	return fmt.Sprintf("'%s'", strings.Replace(value, "'", `'\''`, -1))
+}
+
+// dotenvQuote quotes a value for .env files. Single quotes keep the value as
+// is, double quotes are only used for values they cannot hold.
+func dotenvQuote(value string) string {
+	if !strings.ContainsAny(value, "'\n\r") {
+		return fmt.Sprintf("'%s'", value)
+	}
+
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "$", `\$`)
+	return fmt.Sprintf(`"%s"`, replacer.Replace(value))
+}
+
+// ListDirectory returns the tree of secrets, aliases and directories below a
+// directory of the vault, depth first.
+func ListDirectory(path string) []DirectoryEntry {
+	return listDirectory(path, 0)
+}
+
+func listDirectory(path string, level int) []DirectoryEntry {
+	entries := make([]DirectoryEntry, 0)
+
+	files, err := ioutil.ReadDir(GetSecretPath(path))
+	if err != nil {
+		return entries
+	}
+
+	for _, file := range files {
+		// Vault files such as .git or _vault.meta are not secret names
+		name, err := UnescapePath(file.Name())
+		if err != nil {
+			continue
+		}
+
+		entry := DirectoryEntry{
+			Path:  strings.TrimPrefix(filepath.Join(path, name), "/"),
+			Name:  name,
+			Level: level,
+			Dir:   file.IsDir(),
+		}
+		if !entry.Dir {
+			entry.Target, _ = GetAliasTarget(entry.Path)
+		}
+
+		entries = append(entries, entry)
+		if entry.Dir {
+			entries = append(entries, listDirectory(entry.Path, level+1)...)
+		}
+	}
+
+	return entries
+}
+
+// MarshalSecretList renders a list of secrets and aliases in one of the
+// structured output formats. Directories are left out.
+func MarshalSecretList(entries []DirectoryEntry, format string) ([]byte, error) {
+	secrets := make([]DirectoryEntry, 0)
+	for _, entry := range entries {
+		if !entry.Dir {
+			secrets = append(secrets, entry)
+		}
+	}
+
+	switch format {
+	case OutputJSON:
+		return MarshalJSON(secrets)
+
+	case OutputPaths:
+		var buf bytes.Buffer
+		for _, entry := range secrets {
+			fmt.Fprintln(&buf, entry.Path)
+		}
+		return buf.Bytes(), nil
+	}
+
+	return nil, fmt.Errorf("unknown output format '%s'", format)
+}
@@ -0,0 +1,136 @@
+package util
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestDescribeSecret(t *testing.T) {
+	meta := &SecretMeta{Created: 1500000000, Tags: []string{"web"}}
+	attrs := AttributeMap{
+		"username": &Attribute{Value: "apognu"},
+		"password": &Attribute{Value: "Str0ngP@ss", EyesOnly: true, Type: AttributePassword},
+		"shared":   &Attribute{Value: "token", ResolvedFrom: "infra/svc#token"},
+		"broken":   &Attribute{Reference: "infra/gone#token"},
+	}
+	attrs.Reorder([]string{"username", "password", "shared", "broken"})
+
+	view := DescribeSecret("website.com", meta, attrs, false)
+	assert.Equal(t, []string{"web"}, view.Tags)
+	assert.NotEqual(t, "", view.Created)
+	assert.Equal(t, 4, len(view.Attributes))
+	assert.Equal(t, AttributeView{Name: "username", Value: "apognu", Type: AttributeText}, view.Attributes[0])
+	assert.Equal(t, AttributeView{Name: "password", Type: AttributePassword, EyesOnly: true, Redacted: true}, view.Attributes[1])
+	assert.Equal(t, "infra/svc#token", view.Attributes[2].Reference)
+	assert.Equal(t, AttributeView{Name: "broken", Type: AttributeText, Reference: "infra/gone#token", Unresolved: true}, view.Attributes[3])
+
+	view = DescribeSecret("website.com", meta, attrs, true)
+	assert.Equal(t, "Str0ngP@ss", view.Attributes[1].Value)
+	assert.False(t, view.Attributes[1].Redacted)
+
+	// Structured formats read back to the same view
+	out, err := MarshalSecret(view, OutputJSON)
+	assert.Nil(t, err)
+	var fromJSON SecretView
+	assert.Nil(t, json.Unmarshal(out, &fromJSON))
+	assert.Equal(t, view, fromJSON)
+
+	out, err = MarshalSecret(view, OutputYAML)
+	assert.Nil(t, err)
+	var fromYAML SecretView
+	assert.Nil(t, yaml.Unmarshal(out, &fromYAML))
+	assert.Equal(t, view, fromYAML)
+
+	_, err = MarshalSecret(view, "xml")
+	assert.NotNil(t, err)
+}
+
+func TestDescribeSecretDetails(t *testing.T) {
+	private, public, err := GenerateSSHKey(SSHKeyEd25519, 0, "deploy")
+	assert.Nil(t, err)
+
+	attrs := AttributeMap{
+		"password": &Attribute{Value: "0ld", EyesOnly: true, Pending: &PendingValue{Value: "n3w"}},
+		"privkey":  &Attribute{Value: base64.StdEncoding.EncodeToString(private), EyesOnly: true, File: true},
+		"pubkey":   &Attribute{Value: string(public)},
+	}
+	attrs.Reorder([]string{"password", "privkey", "pubkey"})
+
+	view := DescribeSecret("servers/deploy", &SecretMeta{}, attrs, false)
+	assert.Equal(t, &PendingView{Redacted: true}, view.Attributes[0].Pending, "pending values should be redacted like the attribute")
+	assert.Equal(t, 1, len(view.Attributes[1].SSHKeys))
+	assert.True(t, view.Attributes[1].SSHKeys[0].Private)
+	assert.Equal(t, "", view.Attributes[1].SSHKeys[0].Key, "private keys should only be described by their fingerprint")
+	assert.Equal(t, 1, len(view.Attributes[2].SSHKeys))
+	assert.Equal(t, strings.TrimSpace(string(public)), view.Attributes[2].SSHKeys[0].Key)
+	assert.Equal(t, view.Attributes[1].SSHKeys[0].Fingerprint, view.Attributes[2].SSHKeys[0].Fingerprint)
+
+	view = DescribeSecret("servers/deploy", &SecretMeta{}, attrs, true)
+	assert.Equal(t, &PendingView{Value: "n3w"}, view.Attributes[0].Pending)
+}
+
+func TestEnvOutput(t *testing.T) {
+	view := SecretView{Attributes: []AttributeView{
+		{Name: "db.user", Value: "it's me"},
+		{Name: "password", Redacted: true},
+		{Name: "broken", Unresolved: true},
+		{Name: "2fa-seed", Value: "multi\nline $HOME"},
+	}}
+
+	out, err := MarshalSecret(view, OutputEnv)
+	assert.Nil(t, err)
+	assert.Equal(t, "export DB_USER='it'\\''s me'\nexport _2FA_SEED='multi\nline $HOME'\n", string(out))
+
+	out, err = MarshalSecret(view, OutputDotenv)
+	assert.Nil(t, err)
+	assert.Equal(t, "DB_USER=\"it's me\"\n_2FA_SEED=\"multi\\nline \\$HOME\"\n", string(out))
+
+	view.Attributes[0].Value = "plain"
+	out, err = MarshalSecret(view, OutputDotenv)
+	assert.Nil(t, err)
+	assert.Equal(t, "DB_USER='plain'\n_2FA_SEED=\"multi\\nline \\$HOME\"\n", string(out))
+
+	// Attributes cannot silently overwrite each other
+	view.Attributes = append(view.Attributes, AttributeView{Name: "db-user", Value: "other"})
+	_, err = MarshalSecret(view, OutputEnv)
+	assert.NotNil(t, err)
+}
+
+func TestListDirectory(t *testing.T) {
+	defer withConfigDir(t)()
+
+	dir, err := ioutil.TempDir("", "vault-list")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	vaultDir = dir
+	vaultSelected = true
+
+	assert.Nil(t, os.MkdirAll(dir+"/work/dev", 0700))
+	assert.Nil(t, ioutil.WriteFile(dir+"/work/dev/github", []byte(`{"salt":"","nonce":"","data":""}`), 0600))
+	assert.Nil(t, ioutil.WriteFile(dir+"/_vault.meta", []byte(`{}`), 0600))
+	assert.Nil(t, WriteAlias("github", "work/dev/github"))
+
+	entries := ListDirectory("/")
+	assert.Equal(t, []DirectoryEntry{
+		{Path: "github", Name: "github", Target: "work/dev/github"},
+		{Path: "work", Name: "work", Dir: true},
+		{Path: "work/dev", Name: "dev", Level: 1, Dir: true},
+		{Path: "work/dev/github", Name: "github", Level: 2},
+	}, entries)
+	assert.Equal(t, []DirectoryEntry{{Path: "work/dev/github", Name: "github"}}, ListDirectory("work/dev"))
+
+	out, err := MarshalSecretList(entries, OutputPaths)
+	assert.Nil(t, err)
+	assert.Equal(t, "github\nwork/dev/github\n", string(out))
+
+	out, err = MarshalSecretList(entries, OutputJSON)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `[{"path":"github","alias":"work/dev/github"},{"path":"work/dev/github"}]`, string(out))
+}
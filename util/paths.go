@@ -0,0 +1,135 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Secret paths are made of components separated by slashes. Components are
+// made of ASCII letters, digits and the characters in pathSymbols. They
+// cannot be '.' or '..', start with a dot, which would reach or hide files
+// such as '.git', or start with '_vault.', which is reserved for the files of
+// the vault itself.
+//
+// On disk, lowercase letters, digits, '.', '_' and '-' are kept as is, every
+// other character being written as '%' followed by its lowercase hexadecimal
+// code. Secrets whose names only differ by case therefore never collide on
+// case-insensitive filesystems.
+const (
+	pathSymbols        = "._-@+=,~"
+	pathReservedPrefix = "_vault."
+	pathMaxComponent   = 255
+)
+
+// ValidatePath checks a secret path against the path grammar.
+func ValidatePath(path string) error {
+	if path == "" {
+		return errors.New("empty path")
+	}
+	if strings.HasPrefix(path, "/") {
+		return errors.New("absolute paths are not allowed")
+	}
+
+	for _, component := range strings.Split(path, "/") {
+		switch {
+		case component == "":
+			return errors.New("empty path component")
+		case component == "." || component == "..":
+			return fmt.Errorf("'%s' is not allowed in paths", component)
+		case strings.HasPrefix(component, "."):
+			return fmt.Errorf("'%s' cannot start with a dot", component)
+		case strings.HasPrefix(component, pathReservedPrefix):
+			return fmt.Errorf("'%s' is reserved for vault files", component)
+		case len(escapeComponent(component)) > pathMaxComponent:
+			return fmt.Errorf("'%s' is too long", component)
+		}
+
+		for _, c := range component {
+			if !isPathCharacter(c) {
+				return fmt.Errorf("invalid character %q in '%s'", c, component)
+			}
+		}
+	}
+
+	return nil
+}
+
+func IsValidPath(path string) bool {
+	return ValidatePath(path) == nil
+}
+
+func isPathCharacter(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.ContainsRune(pathSymbols, c)
+}
+
+// isPlainPathCharacter tells whether a character is written as is on disk.
+func isPlainPathCharacter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '.' || c == '_' || c == '-'
+}
+
+// EscapePath returns the location of a secret path on disk, relative to the
+// root of the vault.
+func EscapePath(path string) string {
+	components := strings.Split(path, "/")
+	for i, component := range components {
+		components[i] = escapeComponent(component)
+	}
+	return strings.Join(components, "/")
+}
+
+func escapeComponent(component string) string {
+	var escaped bytes.Buffer
+	for i := 0; i < len(component); i++ {
+		if isPlainPathCharacter(component[i]) {
+			escaped.WriteByte(component[i])
+		} else {
+			fmt.Fprintf(&escaped, "%%%02x", component[i])
+		}
+	}
+	return escaped.String()
+}
+
+// UnescapePath returns the secret path stored at a location on disk. Files
+// whose names could not have been written by EscapePath are rejected.
+func UnescapePath(diskPath string) (string, error) {
+	components := strings.Split(filepath.ToSlash(diskPath), "/")
+	for i, component := range components {
+		var unescaped bytes.Buffer
+		for j := 0; j < len(component); j++ {
+			if component[j] != '%' {
+				unescaped.WriteByte(component[j])
+				continue
+			}
+			if j+2 >= len(component) {
+				return "", fmt.Errorf("invalid escape sequence in '%s'", component)
+			}
+			c, err := strconv.ParseUint(component[j+1:j+3], 16, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape sequence in '%s'", component)
+			}
+			unescaped.WriteByte(byte(c))
+			j += 2
+		}
+		components[i] = unescaped.String()
+	}
+
+	path := strings.Join(components, "/")
+	if err := ValidatePath(path); err != nil {
+		return "", err
+	}
+	if EscapePath(path) != filepath.ToSlash(diskPath) {
+		return "", fmt.Errorf("'%s' is not a canonical secret file name", diskPath)
+	}
+
+	return path, nil
+}
+
+// GetSecretPath returns the location on disk of a secret, or of a directory
+// of secrets.
+func GetSecretPath(path string) string {
+	return fmt.Sprintf("%s/%s", GetVaultPath(), EscapePath(path))
+}
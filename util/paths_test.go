@@ -0,0 +1,112 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidPaths(t *testing.T) {
+	valid := []string{
+		"website",
+		"dir/subdir/website.com",
+		"Example.com",
+		"a_b",
+		"user@host",
+		"mail/john.doe+vault@example.com",
+		"keys/id_rsa.pub",
+		"db/prod=1,replica~2",
+		"a-b/c-d/e-f",
+		"_vault",
+		"vault.meta",
+		"x..y",
+		strings.Repeat("a", 255),
+	}
+
+	for _, path := range valid {
+		assert.Nil(t, ValidatePath(path), "'%s' should be valid", path)
+		assert.True(t, IsValidPath(path))
+	}
+}
+
+func TestInvalidPaths(t *testing.T) {
+	invalid := []string{
+		"",
+		"/",
+		"/etc/passwd",
+		"..",
+		"../secret",
+		"dir/../../secret",
+		"dir/./secret",
+		".",
+		".git",
+		"dir/.git/config",
+		".hidden",
+		"_vault.meta",
+		"_vault.templates",
+		"dir/_vault.meta",
+		"dir/",
+		"dir//secret",
+		"with space",
+		"back\\slash",
+		"colon:name",
+		"hash#name",
+		"percent%41",
+		"star*",
+		"new\nline",
+		"nul\x00",
+		"unicodé",
+		strings.Repeat("a", 256),
+		strings.Repeat("A", 100),
+	}
+
+	for _, path := range invalid {
+		assert.NotNil(t, ValidatePath(path), "'%s' should be invalid", path)
+		assert.False(t, IsValidPath(path))
+	}
+}
+
+func TestEscapePath(t *testing.T) {
+	cases := map[string]string{
+		"website":                "website",
+		"dir/subdir/website.com": "dir/subdir/website.com",
+		"a_b":                    "a_b",
+		"Example.com":            "%45xample.com",
+		"user@host":              "user%40host",
+		"dir/A+B=C,D~E":          "dir/%41%2b%42%3d%43%2c%44%7e%45",
+	}
+
+	for path, escaped := range cases {
+		assert.Equal(t, escaped, EscapePath(path))
+
+		unescaped, err := UnescapePath(escaped)
+		assert.Nil(t, err)
+		assert.Equal(t, path, unescaped, "escaping should be reversible")
+	}
+
+	assert.NotEqual(t, EscapePath("Example.com"), EscapePath("example.com"), "names differing by case should not collide")
+}
+
+func TestUnescapeInvalidPaths(t *testing.T) {
+	invalid := []string{
+		".git",
+		"_vault.meta",
+		"_vault.templates",
+		"Example.com",
+		"%2e%2e",
+		"dir/%2e%2e/secret",
+		"%2f",
+		"a%2fb",
+		"%61",
+		"%4",
+		"%zz",
+		"trailing%",
+		"%2F",
+	}
+
+	for _, path := range invalid {
+		_, err := UnescapePath(path)
+		assert.NotNil(t, err, "'%s' should not be a secret file name", path)
+	}
+}
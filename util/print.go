@@ -1,10 +1,9 @@
 package util
 
 import (
-	"crypto/md5"
 	"fmt"
-	"io/ioutil"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
@@ -12,25 +11,40 @@ import (
 )
 
 var (
-	magenta = color.New(color.FgMagenta).SprintfFunc()
-	blue    = color.New(color.FgBlue).SprintfFunc()
-	red     = color.New(color.FgRed).SprintfFunc()
-	green   = color.New(color.FgGreen).SprintfFunc()
+	magenta   = color.New(color.FgMagenta).SprintfFunc()
+	blue      = color.New(color.FgBlue).SprintfFunc()
+	red       = color.New(color.FgRed).SprintfFunc()
+	green     = color.New(color.FgGreen).SprintfFunc()
+	underline = color.New(color.Underline).SprintfFunc()
+
+	ansiRegex = regexp.MustCompile("\x1b\\[[0-9;]*m")
 )
 
-func FormatAttributes(path string, attrs AttributeMap, print bool) {
+// FormatAttributes prints the attributes of the view of a secret, eyes-only
+// values being printed if print was set when describing it.
+func FormatAttributes(view SecretView, print bool) {
+	// Attributes outside of any section come first, then each section in the
+	// order it first appears
+	sections := make([]string, 0)
+	grouped := make(map[string][]AttributeView)
 	maxLength := 0
-	for k, _ := range attrs {
-		if len(k) > maxLength {
-			maxLength = len(k)
+	for _, attr := range view.Attributes {
+		section, name := AttributeSection(attr.Name)
+		if _, ok := grouped[section]; !ok && section != "" {
+			sections = append(sections, section)
+		}
+		grouped[section] = append(grouped[section], attr)
+
+		if len(name) > maxLength {
+			maxLength = len(name)
 		}
 	}
 
 	maxLength += 10
 
-	lineFmt := fmt.Sprintf(" %%%ds %%s %%s\n", maxLength)
+	prefixFmt := fmt.Sprintf(" %%%ds %%s ", maxLength)
 
-	dir, secretName := filepath.Split(path)
+	dir, secretName := filepath.Split(view.Path)
 	var pathTokens []string
 	if dir == "" {
 		pathTokens = []string{"/"}
@@ -40,62 +54,394 @@ func FormatAttributes(path string, attrs AttributeMap, print bool) {
 
 	fmt.Printf("Store » %s » %s\n", blue(strings.Join(pathTokens, " » ")), secretName)
 
-	for k, v := range attrs {
-		// Redact display of eyes-only attributes if -p is not set
-		if v.EyesOnly {
-			if print {
-				v.Value = red(v.Value)
-			} else {
-				v.Value = red("<redacted>")
-			}
+	printAttribute := func(attr AttributeView) {
+		_, name := AttributeSection(attr.Name)
+		prefix := fmt.Sprintf(prefixFmt, magenta(name), magenta("="))
+		value := formatViewValue(attr, attr.Value, attr.Redacted, print, visibleLength(prefix))
+		if attr.Unresolved {
+			value = red(fmt.Sprintf("<unresolved %s%s>", ReferencePrefix, attr.Reference))
+		} else if attr.Reference != "" {
+			value = fmt.Sprintf("%s %s", value, blue(fmt.Sprintf("(%s%s)", ReferencePrefix, attr.Reference)))
+		}
+		if attr.Expires != "" {
+			value = fmt.Sprintf("%s %s %s", value, blue("expires"), formatExpiry(attr.Expires))
+		}
+		if pending := attr.Pending; pending != nil {
+			value = fmt.Sprintf("%s %s %s", value, blue("pending"), formatViewValue(attr, pending.Value, pending.Redacted, print, 0))
+		}
+		fmt.Printf("%s%s\n", prefix, value)
+
+		// Describe the leaf certificate of certificate files
+		if len(attr.Certificates) > 0 {
+			formatCertificate(attr.Certificates[0], len(attr.Certificates)-1, visibleLength(prefix))
+		}
+		for _, key := range attr.SSHKeys {
+			formatSSHKey(key, visibleLength(prefix))
+		}
+	}
+
+	for _, attr := range grouped[""] {
+		printAttribute(attr)
+	}
+	for _, section := range sections {
+		fmt.Printf("  » %s\n", blue(section))
+
+		for _, attr := range grouped[section] {
+			printAttribute(attr)
+		}
+	}
+}
+
+// FormatSecretMeta prints the metadata of the view of a secret below its
+// attributes. Nothing is printed for secrets stored before metadata was
+// recorded.
+func FormatSecretMeta(view SecretView) {
+	if view.Created == "" && view.Notes == "" && len(view.Tags) == 0 && view.Expires == "" {
+		return
+	}
+
+	fmt.Println()
+	if view.Created != "" {
+		fmt.Printf(" %s %s\n", blue("created"), formatViewTime(view.Created))
+	}
+	if view.Updated != "" {
+		author := ""
+		if view.Author != "" {
+			author = fmt.Sprintf(" with key %s", view.Author)
+		}
+		fmt.Printf(" %s %s%s\n", blue("updated"), formatViewTime(view.Updated), author)
+	}
+	if view.Expires != "" {
+		fmt.Printf(" %s %s\n", blue("expires"), formatExpiry(view.Expires))
+	}
+	if view.Template != "" {
+		fmt.Printf(" %s %s\n", blue("template"), view.Template)
+	}
+	if len(view.Tags) > 0 {
+		fmt.Printf(" %s    %s\n", blue("tags"), green(strings.Join(view.Tags, ", ")))
+	}
+	if view.Notes != "" {
+		// Align continuation lines of multi-line notes under the first one
+		lines := strings.Split(strings.TrimRight(view.Notes, "\n"), "\n")
+		fmt.Printf(" %s   %s\n", blue("notes"), strings.Join(lines, "\n         "))
+	}
+}
+
+// formatViewValue displays a value of an attribute view, either its current
+// one or its pending one.
+func formatViewValue(attr AttributeView, value string, redacted, print bool, indent int) string {
+	if redacted {
+		return red("<redacted>")
+	}
+
+	return formatAttributeValue(&Attribute{Value: value, EyesOnly: attr.EyesOnly, File: attr.File, Type: attr.Type}, print, indent)
+}
+
+// formatViewTime displays a time of a secret view, given as RFC 3339.
+func formatViewTime(value string) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+
+	return t.Local().Format("Mon, 02 Jan 2006, 15:04")
+}
+
+// FormatSecretPaths prints a flat list of secrets, such as the ones matching
+// a filter.
+func FormatSecretPaths(path string, secrets []string) {
+	var pathTokens []string
+	if path == "/" {
+		pathTokens = []string{"/"}
+	} else {
+		pathTokens = strings.Split(filepath.Clean(path), "/")
+	}
+
+	fmt.Printf("Store » %s\n", blue(strings.Join(pathTokens, " » ")))
+
+	for _, secret := range secrets {
+		fmt.Printf("  - %s\n", secret)
+	}
+}
+
+func FormatBackReferences(path string, refs []BackReference) {
+	fmt.Printf("Store » %s\n", blue(strings.Join(strings.Split(filepath.Clean(path), "/"), " » ")))
+
+	if len(refs) == 0 {
+		fmt.Println("  no secret references this one")
+		return
+	}
+
+	for _, ref := range refs {
+		fmt.Printf("  - %s » %s %s %s\n", ref.Path, magenta(ref.Attribute), blue("→"), ref.Target)
+	}
+}
+
+func FormatAttributeHistory(path, name string, attr *Attribute, print bool) {
+	fmt.Printf("Store » %s » %s\n", blue(strings.Join(strings.Split(filepath.Clean(path), "/"), " » ")), magenta(name))
+
+	if len(attr.History) == 0 {
+		fmt.Println("  no previous value")
+		return
+	}
+
+	for idx, entry := range attr.History {
+		replacedOn := time.Unix(entry.ReplacedOn, 0)
+		value := red("<redacted>")
+		switch {
+		case entry.Reference != "":
+			value = blue(fmt.Sprintf("%s%s", ReferencePrefix, entry.Reference))
+		case print:
+			value = formatAttributeValue(&Attribute{Value: entry.Value, EyesOnly: entry.EyesOnly, File: entry.File, Type: entry.Type}, true, 0)
 		}
-		if v.File {
-			if !print {
-				v.Value = green("<file content>")
-			} else {
-				v.Value = fmt.Sprintf("%s (use -w to write file to disk)", green("<file content>"))
+
+		fmt.Printf(" - @%d (%s) %s\n", idx, magenta(replacedOn.Format("Mon, 02 Jan 2006, 15:04")), value)
+	}
+}
+
+// visibleLength returns the length of a string once printed, ignoring
+// terminal color sequences.
+func visibleLength(s string) int {
+	return len(ansiRegex.ReplaceAllString(s, ""))
+}
+
+func formatAttributeValue(attr *Attribute, print bool, indent int) string {
+	t := attr.GetType()
+
+	if attr.Reference != "" {
+		return red(fmt.Sprintf("<unresolved %s%s>", ReferencePrefix, attr.Reference))
+	}
+
+	if attr.File {
+		content := green("<file content>")
+		if types := PEMBlockTypes(attr.Value); len(types) > 0 {
+			content = green(fmt.Sprintf("<PEM: %s>", strings.Join(types, ", ")))
+		}
+		if print {
+			return fmt.Sprintf("%s (use -w to write file to disk)", content)
+		}
+		return content
+	}
+
+	// Redact display of eyes-only attributes if -p is not set
+	if attr.EyesOnly {
+		if !print {
+			return red("<redacted>")
+		}
+		if t != AttributeNote {
+			return red(attr.Value)
+		}
+	}
+
+	switch t {
+	case AttributeURL:
+		return underline(attr.Value)
+	case AttributeDate:
+		days, err := DaysUntil(attr.Value, time.Now())
+		if err != nil {
+			return attr.Value
+		}
+		return fmt.Sprintf("%s %s", attr.Value, formatDays(days, 0))
+	case AttributeNote:
+		// Align continuation lines of multi-line notes under the first one
+		lines := strings.Split(strings.TrimRight(attr.Value, "\n"), "\n")
+		if attr.EyesOnly {
+			for i := range lines {
+				lines[i] = red(lines[i])
 			}
 		}
-		fmt.Printf(lineFmt, magenta(k), magenta("="), v.Value)
+		return strings.Join(lines, fmt.Sprintf("\n%s", strings.Repeat(" ", indent)))
+	}
+
+	return attr.Value
+}
+
+func formatCertificate(cert Certificate, chain int, indent int) {
+	padding := strings.Repeat(" ", indent)
+
+	fmt.Printf("%s%s %s\n", padding, blue("subject"), cert.Subject)
+	if len(cert.SANs) > 0 {
+		fmt.Printf("%s%s    %s\n", padding, blue("SANs"), strings.Join(cert.SANs, ", "))
+	}
+	fmt.Printf("%s%s  %s\n", padding, blue("issuer"), cert.Issuer)
+
+	warning, _ := ParseDuration(ConfigString("expiry.warning"))
+	days, _ := DaysUntil(cert.NotAfter.Local().Format(DateFormat), time.Now())
+	validity := fmt.Sprintf("%s → %s %s", cert.NotBefore.Local().Format(DateFormat), cert.NotAfter.Local().Format(DateFormat), formatDays(days, int(warning.Hours()/24)))
+	if time.Now().Before(cert.NotBefore) {
+		validity = fmt.Sprintf("%s %s", validity, red("(not valid yet)"))
+	}
+	fmt.Printf("%s%s   %s\n", padding, blue("valid"), validity)
+
+	if cert.Key != "" {
+		fmt.Printf("%s%s     %s\n", padding, blue("key"), green(fmt.Sprintf("matches '%s'", cert.Key)))
+	} else {
+		fmt.Printf("%s%s     %s\n", padding, blue("key"), "no matching private key in this secret")
+	}
+	switch {
+	case chain == 1:
+		fmt.Printf("%s%s   1 more certificate\n", padding, blue("chain"))
+	case chain > 1:
+		fmt.Printf("%s%s   %d more certificates\n", padding, blue("chain"), chain)
 	}
 }
 
-func FormatDirectory(path string, level int) {
-	dirPath := fmt.Sprintf("%s/%s", GetVaultPath(), path)
+// formatSSHKey describes an SSH key below the attribute holding it. The
+// public key itself is only printed for public keys, private keys are
+// described by their fingerprint.
+func formatSSHKey(key SSHKeyView, indent int) {
+	padding := strings.Repeat(" ", indent)
 
-	files, err := ioutil.ReadDir(dirPath)
+	if !key.Private {
+		fmt.Printf("%s%s         %s\n", padding, blue("key"), key.Key)
+	}
+	fmt.Printf("%s%s %s\n", padding, blue("fingerprint"), key.Fingerprint)
+}
+
+func FormatCertificates(certs []Certificate) {
+	fmt.Printf("Store » %s\n", blue("certificates"))
+
+	if len(certs) == 0 {
+		fmt.Println("  no certificate")
+		return
+	}
+
+	warning, _ := ParseDuration(ConfigString("expiry.warning"))
+	for _, cert := range certs {
+		days, _ := DaysUntil(cert.NotAfter.Local().Format(DateFormat), time.Now())
+		fmt.Printf("  - %s %s » %s %s %s\n", cert.NotAfter.Local().Format(DateFormat), cert.Path, magenta(cert.Attribute), cert.Subject, formatDays(days, int(warning.Hours()/24)))
+	}
+}
+
+// formatExpiry displays an expiration date, highlighted when it is close.
+func formatExpiry(date string) string {
+	days, err := DaysUntil(date, time.Now())
 	if err != nil {
+		return date
+	}
+
+	warning, _ := ParseDuration(ConfigString("expiry.warning"))
+	return fmt.Sprintf("%s %s", date, formatDays(days, int(warning.Hours()/24)))
+}
+
+// formatDays displays a number of days relative to today, highlighted when it
+// is in the past or within the given number of days.
+func formatDays(days, warning int) string {
+	switch {
+	case days < 0:
+		return red(fmt.Sprintf("(%d days ago)", -days))
+	case days == 0:
+		return red("(today)")
+	case days <= warning:
+		return red(fmt.Sprintf("(in %d days)", days))
+	default:
+		return blue(fmt.Sprintf("(in %d days)", days))
+	}
+}
+
+func FormatExpiries(expiries []Expiry, within time.Duration) {
+	fmt.Printf("Store » %s\n", blue(fmt.Sprintf("expiring within %d days", int(within.Hours()/24))))
+
+	if len(expiries) == 0 {
+		fmt.Println("  nothing is expiring")
 		return
 	}
 
-	// Display styled representation of current directory on first line
-	if level == 0 {
-		var pathTokens []string
-		if path == "/" {
-			pathTokens = []string{"/"}
-		} else {
-			pathTokens = strings.Split(filepath.Clean(path), "/")
+	warning, _ := ParseDuration(ConfigString("expiry.warning"))
+	for _, expiry := range expiries {
+		name := expiry.Path
+		if expiry.Attribute != "" {
+			name = fmt.Sprintf("%s » %s", expiry.Path, magenta(expiry.Attribute))
 		}
 
-		fmt.Printf("Store » %s\n", blue(strings.Join(pathTokens, " » ")))
+		fmt.Printf("  - %s %s %s\n", expiry.Expires, name, formatDays(expiry.Days, int(warning.Hours()/24)))
 	}
+}
 
-	indent := ""
-	for i := 0; i < level*2; i++ {
-		indent = fmt.Sprintf("%s ", indent)
+// FormatDirectory prints the tree of secrets below a directory, as returned
+// by ListDirectory.
+func FormatDirectory(path string, entries []DirectoryEntry) {
+	var pathTokens []string
+	if path == "/" {
+		pathTokens = []string{"/"}
+	} else {
+		pathTokens = strings.Split(filepath.Clean(path), "/")
 	}
 
-	for _, file := range files {
-		if file.Name() == ".git" || file.Name() == "_vault.meta" {
-			continue
+	fmt.Printf("Store » %s\n", blue(strings.Join(pathTokens, " » ")))
+
+	for _, entry := range entries {
+		indent := strings.Repeat(" ", entry.Level*2)
+
+		switch {
+		case entry.Dir:
+			fmt.Printf("%s  » %s\n", indent, blue(entry.Name))
+		case entry.Target != "":
+			fmt.Printf("%s  - %s %s\n", indent, entry.Name, blue(fmt.Sprintf("→ %s", entry.Target)))
+		default:
+			fmt.Printf("%s  - %s\n", indent, entry.Name)
+		}
+	}
+}
+
+func FormatConfig(keys []string) {
+	for _, key := range keys {
+		value, origin := GetConfigValue(key)
+		fmt.Printf(" %s = %v %s\n", magenta(key), value, blue(fmt.Sprintf("(%s)", origin)))
+	}
+}
+
+func FormatVaultList(registry *VaultRegistry) {
+	for _, name := range registry.Names() {
+		marker := ""
+		if name == registry.Default {
+			marker = green(" (default)")
 		}
 
-		if file.IsDir() {
-			fmt.Printf("%s  » %s\n", indent, blue(file.Name()))
+		fmt.Printf(" - %s%s\n", magenta(name), marker)
+		fmt.Printf("       %s\n", registry.Vaults[name])
+	}
+}
+
+func FormatGenerators() {
+	for _, kind := range GeneratorKinds() {
+		generator := Generators[kind]
+
+		length := generator.Length
+		if kind == GeneratorPassword {
+			length = ConfigInt("generator.length")
+		}
+
+		details := ""
+		if generator.Sized {
+			details = fmt.Sprintf(" (N=%d by default)", length)
+		}
+
+		fmt.Printf(" - %s %s%s\n", magenta(kind), blue(generator.Description), details)
+	}
+}
+
+func FormatTemplates(templates map[string]*Template) {
+	for _, name := range TemplateNames(templates) {
+		template := templates[name]
+		fmt.Printf(" - %s %s\n", magenta(name), blue(template.Description))
+
+		for _, attr := range template.Attributes {
+			details := make([]string, 0)
+			if attr.Type != "" {
+				details = append(details, attr.Type)
+			}
+			if attr.Required {
+				details = append(details, green("required"))
+			}
+			if attr.Generate {
+				details = append(details, "generated")
+			}
+			if attr.Pattern != "" {
+				details = append(details, fmt.Sprintf("matching %s", attr.Pattern))
+			}
 
-			FormatDirectory(fmt.Sprintf("%s/%s", path, file.Name()), level+1)
-		} else {
-			fmt.Printf("%s  - %s\n", indent, file.Name())
+			fmt.Printf("       %s (%s)\n", attr.Name, strings.Join(details, ", "))
 		}
 	}
 }
@@ -103,10 +449,8 @@ func FormatDirectory(path string, level int) {
 func FormatKeyList(keys []MasterKey) {
 	for idx, key := range keys {
 		createdOn := time.Unix(int64(key.CreatedOn), 0)
-		hash := md5.New()
-		hash.Write([]byte(key.Data))
 
 		fmt.Printf(" - #%d (%s) %s\n", idx, magenta(createdOn.Format("Tue, 02 Jan 2006, 15:04")), key.Comment)
-		fmt.Printf("       %x\n", hash.Sum(nil))
+		fmt.Printf("       %s\n", key.Fingerprint())
 	}
 }
@@ -0,0 +1,35 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ReferencePrefix introduces attribute values pointing to an attribute of
+// another secret, as in 'ref:infra/svc-account#password'.
+const ReferencePrefix = "ref:"
+
+// BackReference is an attribute referencing an attribute of another secret.
+type BackReference struct {
+	Path      string
+	Attribute string
+	Target    string
+}
+
+// ParseReference splits a 'path#attribute' reference.
+func ParseReference(ref string) (string, string, error) {
+	idx := strings.LastIndex(ref, "#")
+	if idx < 0 {
+		return "", "", fmt.Errorf("invalid reference '%s', expected path#attribute", ref)
+	}
+
+	path, attr := ref[:idx], ref[idx+1:]
+	if !IsValidPath(path) {
+		return "", "", fmt.Errorf("invalid secret path in reference '%s'", ref)
+	}
+	if attr == "" {
+		return "", "", fmt.Errorf("missing attribute name in reference '%s'", ref)
+	}
+
+	return path, attr, nil
+}
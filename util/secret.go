@@ -1,5 +1,14 @@
 package util
 
+import (
+	"crypto/md5"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
 const (
 	BpkdfIterations = 8192
 	BpkdfKeySize    = 32
@@ -13,22 +22,89 @@ type MasterKey struct {
 	Data      string `json:"data"`
 }
 
+// Fingerprint identifies a key slot, as printed by vault key list.
+func (k MasterKey) Fingerprint() string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(k.Data)))
+}
+
 type VaultMeta struct {
-	UUID string `json:"uuid"`
+	UUID       string      `json:"uuid"`
 	MasterKeys []MasterKey `json:"master_keys"`
 }
 
 type AttributeMap map[string]*Attribute
 
 func (m AttributeMap) FindFirstEyesOnly() string {
-	for k, v := range m {
-		if v.EyesOnly {
+	for _, k := range m.Keys() {
+		if m[k].EyesOnly {
 			return k
 		}
 	}
 	return ""
 }
 
+// Keys returns the attribute names in display order: by position, then by
+// name for attributes stored before positions were recorded.
+func (m AttributeMap) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]].Position != m[keys[j]].Position {
+			return m[keys[i]].Position < m[keys[j]].Position
+		}
+		return keys[i] < keys[j]
+	})
+
+	return keys
+}
+
+// Add inserts an attribute after all existing ones.
+func (m AttributeMap) Add(name string, attr *Attribute) {
+	max := 0
+	for _, v := range m {
+		if v.Position > max {
+			max = v.Position
+		}
+	}
+
+	attr.Position = max + 1
+	m[name] = attr
+}
+
+// Reorder moves the given attributes first, in that order, followed by the
+// other ones in their current order. Positions are renumbered from 1.
+func (m AttributeMap) Reorder(first []string) {
+	keys := make([]string, 0, len(m))
+	for _, k := range first {
+		if m[k] != nil && !StringArrayContains(keys, k) {
+			keys = append(keys, k)
+		}
+	}
+	for _, k := range m.Keys() {
+		if !StringArrayContains(keys, k) {
+			keys = append(keys, k)
+		}
+	}
+
+	for i, k := range keys {
+		m[k].Position = i + 1
+	}
+}
+
+// AttributeSection splits an attribute name such as 'admin.username' into
+// its section and its name within the section. The section is empty for
+// attributes that do not belong to one.
+func AttributeSection(name string) (string, string) {
+	idx := strings.Index(name, ".")
+	if idx <= 0 || idx == len(name)-1 {
+		return "", name
+	}
+	return name[:idx], name[idx+1:]
+}
+
 func (m AttributeMap) EyesOnlyCount() int {
 	i := 0
 	for _, v := range m {
@@ -43,10 +119,142 @@ type Attribute struct {
 	Value    string `json:"value"`
 	EyesOnly bool   `json:"eyesonly"`
 	File     bool   `json:"file"`
+	Type     string `json:"type,omitempty"`
+	Position int    `json:"position,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+
+	// Reference points to the attribute holding the value, as 'path#attr'
+	Reference string `json:"reference,omitempty"`
+	// ResolvedFrom is the reference an attribute was read through
+	ResolvedFrom string `json:"-"`
+	// Generator is how the value was generated, if it was
+	Generator *GeneratorParams `json:"generator,omitempty"`
+	// Pending is a new value waiting to be confirmed
+	Pending *PendingValue `json:"pending,omitempty"`
+
+	History []AttributeHistory `json:"history,omitempty"`
+}
+
+// PendingValue is a new value of an attribute, kept alongside the current
+// one until it is confirmed or discarded.
+type PendingValue struct {
+	Value     string           `json:"value"`
+	Generator *GeneratorParams `json:"generator,omitempty"`
+	Created   int64            `json:"created"`
+}
+
+// AttributeHistory is a previous value of an attribute, as it was before
+// being replaced.
+type AttributeHistory struct {
+	Value      string           `json:"value"`
+	EyesOnly   bool             `json:"eyesonly"`
+	File       bool             `json:"file"`
+	Type       string           `json:"type,omitempty"`
+	Reference  string           `json:"reference,omitempty"`
+	Generator  *GeneratorParams `json:"generator,omitempty"`
+	ReplacedOn int64            `json:"replaced_on"`
+}
+
+func (a *Attribute) snapshot() AttributeHistory {
+	return AttributeHistory{
+		Value:      a.Value,
+		EyesOnly:   a.EyesOnly,
+		File:       a.File,
+		Type:       a.Type,
+		Reference:  a.Reference,
+		Generator:  a.Generator,
+		ReplacedOn: time.Now().Unix(),
+	}
+}
+
+// Replace makes next take the place of the attribute, archiving the current
+// value at the top of its history. At most size previous values are kept.
+func (a *Attribute) Replace(next *Attribute, size int) {
+	next.Position = a.Position
+	next.History = truncateHistory(append([]AttributeHistory{a.snapshot()}, a.History...), size)
+}
+
+// ConfirmPending returns the attribute holding the pending value in place of
+// the current one, which is archived in its history.
+func (a *Attribute) ConfirmPending(size int) (*Attribute, error) {
+	if a.Pending == nil {
+		return nil, fmt.Errorf("no pending value")
+	}
+
+	next := &Attribute{
+		Value:     a.Pending.Value,
+		EyesOnly:  a.EyesOnly,
+		File:      a.File,
+		Type:      a.Type,
+		Expires:   a.Expires,
+		Generator: a.Pending.Generator,
+	}
+	a.Replace(next, size)
+
+	return next, nil
+}
+
+// Revert restores the nth previous value of the attribute, the current value
+// being archived in its place.
+func (a *Attribute) Revert(n int, size int) error {
+	if n < 0 || n >= len(a.History) {
+		return fmt.Errorf("no previous value #%d", n)
+	}
+
+	entry := a.History[n]
+	history := append([]AttributeHistory{a.snapshot()}, a.History[:n]...)
+	history = append(history, a.History[n+1:]...)
+
+	a.Value = entry.Value
+	a.EyesOnly = entry.EyesOnly
+	a.File = entry.File
+	a.Type = entry.Type
+	a.Reference = entry.Reference
+	a.Generator = entry.Generator
+	a.History = truncateHistory(history, size)
+
+	return nil
+}
+
+func truncateHistory(history []AttributeHistory, size int) []AttributeHistory {
+	if size <= 0 {
+		return nil
+	}
+	if len(history) > size {
+		return history[:size]
+	}
+	return history
+}
+
+// ParseHistoryRef splits the 'attr@N' syntax used to designate a previous
+// value of an attribute. N defaults to 0, the most recent previous value.
+func ParseHistoryRef(ref string) (string, int, error) {
+	idx := strings.LastIndex(ref, "@")
+	if idx < 0 {
+		return ref, 0, nil
+	}
+
+	n, err := strconv.Atoi(ref[idx+1:])
+	if err != nil || n < 0 {
+		return "", 0, fmt.Errorf("invalid history index in '%s'", ref)
+	}
+
+	return ref[:idx], n, nil
 }
 
 type Secret struct {
 	Salt  string `json:"salt"`
 	Nonce string `json:"nonce"`
 	Data  string `json:"data"`
+
+	// Meta holds the encrypted SecretMeta, it is absent from secrets created
+	// before metadata was recorded
+	Meta *SecretBlock `json:"meta,omitempty"`
+}
+
+// SecretBlock is a piece of encrypted data stored next to the attributes.
+type SecretBlock struct {
+	Salt  string `json:"salt"`
+	Nonce string `json:"nonce"`
+	Data  string `json:"data"`
 }
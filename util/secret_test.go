@@ -0,0 +1,127 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttributeOrder(t *testing.T) {
+	attrs := AttributeMap{
+		"password": &Attribute{Value: "secret"},
+		"username": &Attribute{Value: "apognu"},
+	}
+	assert.Equal(t, []string{"password", "username"}, attrs.Keys(), "attributes without positions should be sorted by name")
+
+	attrs.Add("url", &Attribute{Value: "http://example.com"})
+	attrs.Add("email", &Attribute{Value: "apognu@example.com"})
+	assert.Equal(t, []string{"password", "username", "url", "email"}, attrs.Keys(), "added attributes should go last")
+
+	attrs.Reorder([]string{"username", "unknown"})
+	assert.Equal(t, []string{"username", "password", "url", "email"}, attrs.Keys())
+	assert.Equal(t, 1, attrs["username"].Position)
+	assert.Equal(t, 4, attrs["email"].Position)
+}
+
+func TestAttributeSection(t *testing.T) {
+	section, name := AttributeSection("admin.username")
+	assert.Equal(t, "admin", section)
+	assert.Equal(t, "username", name)
+
+	section, name = AttributeSection("api.token.old")
+	assert.Equal(t, "api", section)
+	assert.Equal(t, "token.old", name)
+
+	for _, k := range []string{"username", ".hidden", "trailing."} {
+		section, name = AttributeSection(k)
+		assert.Equal(t, "", section)
+		assert.Equal(t, k, name)
+	}
+}
+
+func TestParseAttributeArgs(t *testing.T) {
+	keys, values, err := ParseAttributeArgs([]string{"username=apognu", "password=", "url=http://example.com/?a=b", "username=other"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"username", "password", "url"}, keys)
+	assert.Equal(t, "other", values["username"])
+	assert.Equal(t, "", values["password"])
+	assert.Equal(t, "http://example.com/?a=b", values["url"])
+
+	_, _, err = ParseAttributeArgs([]string{"username"})
+	assert.NotNil(t, err)
+}
+
+func TestAttributeHistory(t *testing.T) {
+	attr := &Attribute{Value: "first", Position: 3}
+
+	for _, v := range []string{"second", "third", "fourth"} {
+		next := &Attribute{Value: v}
+		attr.Replace(next, 2)
+		attr = next
+	}
+
+	assert.Equal(t, "fourth", attr.Value)
+	assert.Equal(t, 3, attr.Position, "replacing an attribute should keep its place")
+	assert.Equal(t, 2, len(attr.History), "history should be bounded")
+	assert.Equal(t, "third", attr.History[0].Value, "most recent value should come first")
+	assert.Equal(t, "second", attr.History[1].Value)
+
+	assert.Nil(t, attr.Revert(1, 2))
+	assert.Equal(t, "second", attr.Value)
+	assert.Equal(t, "fourth", attr.History[0].Value, "reverted value should be archived")
+	assert.Equal(t, "third", attr.History[1].Value)
+
+	assert.NotNil(t, attr.Revert(2, 2))
+
+	next := &Attribute{Value: "fifth"}
+	attr.Replace(next, 0)
+	assert.Nil(t, next.History, "history should be disabled with a size of 0")
+}
+
+func TestGeneratedAttributeHistory(t *testing.T) {
+	generated := time.Date(2017, 10, 1, 0, 0, 0, 0, time.UTC)
+	attr := &Attribute{Value: "first", Generator: &GeneratorParams{Kind: "hex", Length: 16, Generated: generated.Unix()}}
+	assert.True(t, attr.GeneratedBefore(generated.Add(time.Hour)))
+	assert.False(t, attr.GeneratedBefore(generated))
+
+	next := &Attribute{Value: "typed"}
+	assert.False(t, next.GeneratedBefore(time.Now()), "typed values were not generated")
+
+	attr.Replace(next, 5)
+	assert.Nil(t, next.Revert(0, 5))
+	assert.Equal(t, "first", next.Value)
+	assert.Equal(t, "hex", next.Generator.Kind, "reverting should restore how the value was generated")
+}
+
+func TestConfirmPending(t *testing.T) {
+	attr := &Attribute{Value: "current", EyesOnly: true, Position: 2, Expires: "2018-01-01"}
+	_, err := attr.ConfirmPending(5)
+	assert.NotNil(t, err, "attributes without a pending value cannot be confirmed")
+
+	attr.Pending = &PendingValue{Value: "next", Generator: &GeneratorParams{Kind: "hex"}}
+	next, err := attr.ConfirmPending(5)
+	assert.Nil(t, err)
+	assert.Equal(t, "next", next.Value)
+	assert.Nil(t, next.Pending)
+	assert.True(t, next.EyesOnly)
+	assert.Equal(t, 2, next.Position)
+	assert.Equal(t, "2018-01-01", next.Expires)
+	assert.Equal(t, "hex", next.Generator.Kind)
+	assert.Equal(t, "current", next.History[0].Value, "the confirmed value should replace the current one")
+}
+
+func TestParseHistoryRef(t *testing.T) {
+	name, n, err := ParseHistoryRef("password")
+	assert.Nil(t, err)
+	assert.Equal(t, "password", name)
+	assert.Equal(t, 0, n)
+
+	name, n, err = ParseHistoryRef("admin.password@2")
+	assert.Nil(t, err)
+	assert.Equal(t, "admin.password", name)
+	assert.Equal(t, 2, n)
+
+	_, _, err = ParseHistoryRef("password@last")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,234 @@
+package util
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	SSHKeyEd25519 = "ed25519"
+	SSHKeyRSA     = "rsa"
+
+	// MinRSABits is the smallest RSA modulus vault agrees to generate.
+	MinRSABits = 2048
+
+	openSSHMagic = "openssh-key-v1\x00"
+)
+
+var SSHKeyTypes = []string{SSHKeyEd25519, SSHKeyRSA}
+
+// SSHKey describes an SSH public key stored in an attribute, either as an
+// authorized_keys line or as the public half of an OpenSSH private key.
+type SSHKey struct {
+	Attribute string
+	Key       ssh.PublicKey
+	Comment   string
+	Private   bool
+}
+
+// AuthorizedKey returns the key formatted as an authorized_keys line.
+func (k SSHKey) AuthorizedKey() string {
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(k.Key)))
+	if k.Comment != "" {
+		line = fmt.Sprintf("%s %s", line, k.Comment)
+	}
+	return line
+}
+
+// Fingerprint returns the SHA256 fingerprint of the key, as printed by
+// ssh-keygen -l.
+func (k SSHKey) Fingerprint() string {
+	return ssh.FingerprintSHA256(k.Key)
+}
+
+// GenerateSSHKey generates an SSH key pair. The private key is returned
+// unencrypted in the OpenSSH format, and the public key as an authorized_keys
+// line.
+func GenerateSSHKey(keyType string, bits int, comment string) ([]byte, []byte, error) {
+	if strings.ContainsAny(comment, "\r\n") {
+		return nil, nil, fmt.Errorf("key comment cannot span several lines")
+	}
+
+	var public ssh.PublicKey
+	var private []byte
+
+	switch keyType {
+	case SSHKeyEd25519:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		if public, err = ssh.NewPublicKey(pub); err != nil {
+			return nil, nil, err
+		}
+
+		private = ssh.Marshal(struct {
+			Pub  []byte
+			Priv []byte
+		}{[]byte(pub), []byte(priv)})
+
+	case SSHKeyRSA:
+		if bits < MinRSABits {
+			return nil, nil, fmt.Errorf("RSA keys must be at least %d bits long", MinRSABits)
+		}
+
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return nil, nil, err
+		}
+		if public, err = ssh.NewPublicKey(&key.PublicKey); err != nil {
+			return nil, nil, err
+		}
+
+		private = ssh.Marshal(struct {
+			N    *big.Int
+			E    *big.Int
+			D    *big.Int
+			IQMP *big.Int
+			P    *big.Int
+			Q    *big.Int
+		}{key.N, big.NewInt(int64(key.E)), key.D, new(big.Int).ModInverse(key.Primes[1], key.Primes[0]), key.Primes[0], key.Primes[1]})
+
+	default:
+		return nil, nil, fmt.Errorf("unknown SSH key type '%s'", keyType)
+	}
+
+	data, err := marshalOpenSSHPrivateKey(public, private, comment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	authorized := SSHKey{Key: public, Comment: comment}.AuthorizedKey() + "\n"
+
+	return pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: data}), []byte(authorized), nil
+}
+
+// marshalOpenSSHPrivateKey wraps a private key in the unencrypted
+// openssh-key-v1 format written by ssh-keygen, which is the only format
+// OpenSSH reads Ed25519 keys from. key holds the fields specific to the type
+// of the key.
+func marshalOpenSSHPrivateKey(public ssh.PublicKey, key []byte, comment string) ([]byte, error) {
+	check := make([]byte, 4)
+	if _, err := rand.Read(check); err != nil {
+		return nil, err
+	}
+
+	var private bytes.Buffer
+	private.Write(check)
+	private.Write(check)
+	private.Write(ssh.Marshal(struct{ KeyType string }{public.Type()}))
+	private.Write(key)
+	private.Write(ssh.Marshal(struct{ Comment string }{comment}))
+	for i := byte(1); private.Len()%8 != 0; i++ {
+		private.WriteByte(i)
+	}
+
+	data := ssh.Marshal(struct {
+		CipherName string
+		KDFName    string
+		KDFOptions string
+		KeyCount   uint32
+		PublicKey  []byte
+		PrivateKey []byte
+	}{"none", "none", "", 1, public.Marshal(), private.Bytes()})
+
+	return append([]byte(openSSHMagic), data...), nil
+}
+
+// parseOpenSSHPublicKey reads the public key stored in the clear at the
+// start of an openssh-key-v1 private key, even when the key is encrypted.
+func parseOpenSSHPublicKey(data []byte) (ssh.PublicKey, error) {
+	if !bytes.HasPrefix(data, []byte(openSSHMagic)) {
+		return nil, fmt.Errorf("not an OpenSSH private key")
+	}
+
+	var header struct {
+		CipherName string
+		KDFName    string
+		KDFOptions string
+		KeyCount   uint32
+		PublicKey  []byte
+		Rest       []byte `ssh:"rest"`
+	}
+	if err := ssh.Unmarshal(data[len(openSSHMagic):], &header); err != nil {
+		return nil, err
+	}
+	if header.KeyCount != 1 {
+		return nil, fmt.Errorf("OpenSSH private keys holding %d keys are not supported", header.KeyCount)
+	}
+
+	return ssh.ParsePublicKey(header.PublicKey)
+}
+
+// ParseSSHKeys returns the SSH public keys stored in an attribute, from
+// authorized_keys lines or from OpenSSH private keys.
+func ParseSSHKeys(name string, attr *Attribute) []SSHKey {
+	content := []byte(attr.Value)
+	if attr.File {
+		var err error
+		if content, err = base64.StdEncoding.DecodeString(attr.Value); err != nil {
+			return nil
+		}
+	}
+
+	keys := make([]SSHKey, 0)
+
+	if blocks := pemBlocks(attr); len(blocks) > 0 {
+		for _, block := range blocks {
+			if block.Type != "OPENSSH PRIVATE KEY" {
+				continue
+			}
+			if key, err := parseOpenSSHPublicKey(block.Bytes); err == nil {
+				keys = append(keys, SSHKey{Attribute: name, Key: key, Private: true})
+			}
+		}
+
+		return keys
+	}
+
+	for len(bytes.TrimSpace(content)) > 0 {
+		key, comment, _, rest, err := ssh.ParseAuthorizedKey(content)
+		if err != nil {
+			break
+		}
+
+		keys = append(keys, SSHKey{Attribute: name, Key: key, Comment: comment})
+		content = rest
+	}
+
+	return keys
+}
+
+// SecretSSHKeys returns the SSH public keys stored in a secret, each key
+// appearing once even when both halves of the pair are stored. Comments of
+// authorized_keys lines are kept.
+func SecretSSHKeys(attrs AttributeMap) []SSHKey {
+	keys := make([]SSHKey, 0)
+	seen := make(map[string]int)
+
+	for _, k := range attrs.Keys() {
+		for _, key := range ParseSSHKeys(k, attrs[k]) {
+			fingerprint := key.Fingerprint()
+			if i, ok := seen[fingerprint]; ok {
+				if keys[i].Comment == "" {
+					keys[i].Comment = key.Comment
+				}
+				continue
+			}
+
+			seen[fingerprint] = len(keys)
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
@@ -3,12 +3,17 @@ package util
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/Sirupsen/logrus"
 )
 
-var vaultDir = fmt.Sprintf("%s/.vault", os.Getenv("HOME"))
+var (
+	vaultDir      = fmt.Sprintf("%s/.vault", os.Getenv("HOME"))
+	vaultName     = ""
+	vaultSelected = false
+)
 
 func AssertVaultExists() {
 	if _, err := os.Stat(GetVaultPath()); os.IsNotExist(err) {
@@ -20,9 +25,39 @@ func AssertVaultExists() {
 }
 
 func GetVaultPath() string {
-	if os.Getenv("VAULT_PATH") != "" {
+	if !vaultSelected && os.Getenv("VAULT_PATH") != "" {
 		vaultDir = os.Getenv("VAULT_PATH")
 	}
 
 	return strings.TrimSuffix(vaultDir, "/")
 }
+
+// ListSecretPaths returns the path of every secret below the given directory
+// of the vault, relative to the root of the vault.
+func ListSecretPaths(dir string) ([]string, error) {
+	secrets := make([]string, 0)
+	err := filepath.Walk(GetSecretPath(dir), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if walk, err := ShouldFileBeWalked(path); !walk {
+			return err
+		}
+
+		diskPath, err := filepath.Rel(GetVaultPath(), path)
+		if err != nil {
+			return err
+		}
+
+		// Files that do not hold secrets are ignored
+		secretPath, err := UnescapePath(diskPath)
+		if err != nil {
+			return nil
+		}
+		secrets = append(secrets, secretPath)
+
+		return nil
+	})
+
+	return secrets, err
+}
@@ -0,0 +1,202 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Template describes the shape of a family of secrets: which attributes they
+// hold, of which type, and how their values are checked or generated.
+type Template struct {
+	Name        string              `toml:"-"`
+	Description string              `toml:"description"`
+	Attributes  []TemplateAttribute `toml:"attributes"`
+}
+
+// TemplateAttribute declares an attribute of a template. Attributes with
+// Generate set get a generated value of the given length when missing.
+type TemplateAttribute struct {
+	Name     string `toml:"name"`
+	Type     string `toml:"type"`
+	Required bool   `toml:"required"`
+	Generate bool   `toml:"generate"`
+	Length   int    `toml:"length"`
+	Symbols  bool   `toml:"symbols"`
+	Pattern  string `toml:"pattern"`
+}
+
+var builtinTemplates = map[string]*Template{
+	"login": {
+		Description: "Website login",
+		Attributes: []TemplateAttribute{
+			{Name: "url", Type: AttributeURL, Required: true},
+			{Name: "username", Type: AttributeText, Required: true},
+			{Name: "password", Type: AttributePassword, Required: true, Generate: true},
+			{Name: "totp", Type: AttributeTOTP},
+		},
+	},
+	"db": {
+		Description: "Database credentials",
+		Attributes: []TemplateAttribute{
+			{Name: "host", Type: AttributeText, Required: true},
+			{Name: "port", Type: AttributeText, Pattern: "^[0-9]+$"},
+			{Name: "database", Type: AttributeText},
+			{Name: "username", Type: AttributeText, Required: true},
+			{Name: "password", Type: AttributePassword, Required: true, Generate: true, Length: 32},
+		},
+	},
+	"ssh": {
+		Description: "SSH host access",
+		Attributes: []TemplateAttribute{
+			{Name: "host", Type: AttributeText, Required: true},
+			{Name: "port", Type: AttributeText, Pattern: "^[0-9]+$"},
+			{Name: "username", Type: AttributeText, Required: true},
+			{Name: "privkey", Type: AttributePEM},
+			{Name: "passphrase", Type: AttributePassword},
+		},
+	},
+}
+
+// GetTemplatesPath returns the file holding the templates defined for the
+// current vault, shared through git along with the secrets.
+func GetTemplatesPath() string {
+	return fmt.Sprintf("%s/_vault.templates", GetVaultPath())
+}
+
+// LoadTemplates returns the built-in templates and the ones defined in the
+// vault, which take precedence over built-in templates of the same name.
+func LoadTemplates() (map[string]*Template, error) {
+	templates := make(map[string]*Template)
+	for name, template := range builtinTemplates {
+		templates[name] = template
+	}
+
+	defined := make(map[string]*Template)
+	if _, err := toml.DecodeFile(GetTemplatesPath(), &defined); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read templates: %s", err)
+	}
+	for name, template := range defined {
+		if err := template.check(); err != nil {
+			return nil, fmt.Errorf("invalid template '%s': %s", name, err)
+		}
+		templates[name] = template
+	}
+
+	for name, template := range templates {
+		template.Name = name
+	}
+
+	return templates, nil
+}
+
+func GetTemplate(name string) (*Template, error) {
+	templates, err := LoadTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	template, ok := templates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown template '%s'", name)
+	}
+
+	return template, nil
+}
+
+// TemplateNames returns the names of all available templates, sorted.
+func TemplateNames(templates map[string]*Template) []string {
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (t *Template) check() error {
+	seen := make(map[string]bool)
+	for _, attr := range t.Attributes {
+		if attr.Name == "" {
+			return fmt.Errorf("attribute without a name")
+		}
+		if seen[attr.Name] {
+			return fmt.Errorf("attribute '%s' is declared twice", attr.Name)
+		}
+		seen[attr.Name] = true
+
+		if attr.Type != "" && !IsValidAttributeType(attr.Type) {
+			return fmt.Errorf("attribute '%s' has unknown type '%s'", attr.Name, attr.Type)
+		}
+		if attr.Generate && IsFileType(attr.Type) {
+			return fmt.Errorf("attribute '%s' cannot be generated", attr.Name)
+		}
+		if attr.Length < 0 {
+			return fmt.Errorf("attribute '%s' has a negative length", attr.Name)
+		}
+		if _, err := regexp.Compile(attr.Pattern); err != nil {
+			return fmt.Errorf("attribute '%s' has an invalid pattern: %s", attr.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Attribute returns the declaration of an attribute, or nil if the template
+// does not declare it.
+func (t *Template) Attribute(name string) *TemplateAttribute {
+	for i := range t.Attributes {
+		if t.Attributes[i].Name == name {
+			return &t.Attributes[i]
+		}
+	}
+	return nil
+}
+
+// Names returns the declared attribute names, in the order of the template.
+func (t *Template) Names() []string {
+	names := make([]string, 0, len(t.Attributes))
+	for _, attr := range t.Attributes {
+		names = append(names, attr.Name)
+	}
+	return names
+}
+
+// Missing returns the required attributes absent from a secret.
+func (t *Template) Missing(attrs AttributeMap) []TemplateAttribute {
+	missing := make([]TemplateAttribute, 0)
+	for _, attr := range t.Attributes {
+		if attr.Required && attrs[attr.Name] == nil {
+			missing = append(missing, attr)
+		}
+	}
+	return missing
+}
+
+// Validate checks a secret against the template. Attributes the template
+// does not declare are allowed.
+func (t *Template) Validate(attrs AttributeMap) error {
+	if missing := t.Missing(attrs); len(missing) > 0 {
+		return fmt.Errorf("attribute '%s' is required by template '%s'", missing[0].Name, t.Name)
+	}
+
+	for _, decl := range t.Attributes {
+		attr := attrs[decl.Name]
+		if attr == nil {
+			continue
+		}
+
+		if decl.Type != "" && attr.GetType() != decl.Type {
+			return fmt.Errorf("attribute '%s' should be of type %s, not %s", decl.Name, decl.Type, attr.GetType())
+		}
+		if decl.Pattern != "" && !attr.File && attr.Reference == "" && !regexp.MustCompile(decl.Pattern).MatchString(attr.Value) {
+			return fmt.Errorf("attribute '%s' does not match '%s'", decl.Name, decl.Pattern)
+		}
+	}
+
+	return nil
+}
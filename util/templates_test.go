@@ -0,0 +1,87 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateValidation(t *testing.T) {
+	template := builtinTemplates["db"]
+
+	attrs := AttributeMap{
+		"host":     &Attribute{Value: "db.example.com", Type: AttributeText},
+		"username": &Attribute{Value: "app"},
+	}
+	assert.Equal(t, "password", template.Missing(attrs)[0].Name)
+	assert.NotNil(t, template.Validate(attrs), "missing required attributes should be rejected")
+
+	attrs["password"] = &Attribute{Value: "secret", EyesOnly: true, Type: AttributePassword}
+	assert.Nil(t, template.Validate(attrs))
+
+	attrs["port"] = &Attribute{Value: "five"}
+	assert.NotNil(t, template.Validate(attrs), "attributes should match the template pattern")
+	attrs["port"].Value = "5432"
+	assert.Nil(t, template.Validate(attrs))
+
+	attrs["host"].Type = AttributeURL
+	assert.NotNil(t, template.Validate(attrs), "attributes should have the template type")
+	attrs["host"].Type = AttributeText
+
+	attrs["comment"] = &Attribute{Value: "undeclared attributes are allowed"}
+	assert.Nil(t, template.Validate(attrs))
+}
+
+func TestLoadTemplates(t *testing.T) {
+	defer withConfigDir(t)()
+
+	dir, err := ioutil.TempDir("", "vault-templates")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	vaultDir = dir
+	vaultSelected = true
+
+	err = ioutil.WriteFile(GetTemplatesPath(), []byte(`
+[db]
+description = "Internal database"
+
+[[db.attributes]]
+name = "dsn"
+type = "url"
+required = true
+
+[wifi]
+description = "Wireless network"
+
+[[wifi.attributes]]
+name = "ssid"
+required = true
+
+[[wifi.attributes]]
+name = "psk"
+type = "password"
+generate = true
+length = 63
+`), 0600)
+	assert.Nil(t, err)
+
+	templates, err := LoadTemplates()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"db", "login", "ssh", "wifi"}, TemplateNames(templates))
+	assert.Equal(t, []string{"dsn"}, templates["db"].Names(), "vault templates should override built-in ones")
+	assert.Equal(t, "wifi", templates["wifi"].Name)
+	assert.Equal(t, 63, templates["wifi"].Attribute("psk").Length)
+
+	err = ioutil.WriteFile(GetTemplatesPath(), []byte(`
+[broken]
+[[broken.attributes]]
+name = "when"
+type = "timestamp"
+`), 0600)
+	assert.Nil(t, err)
+
+	_, err = LoadTemplates()
+	assert.NotNil(t, err, "templates with unknown types should be rejected")
+}
@@ -0,0 +1,150 @@
+package util
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	AttributeText     = "text"
+	AttributePassword = "password"
+	AttributeURL      = "url"
+	AttributeEmail    = "email"
+	AttributeDate     = "date"
+	AttributeNote     = "note"
+	AttributeTOTP     = "totp"
+	AttributeFile     = "file"
+	AttributePEM      = "pem"
+
+	DateFormat = "2006-01-02"
+)
+
+var AttributeTypes = []string{
+	AttributeText,
+	AttributePassword,
+	AttributeURL,
+	AttributeEmail,
+	AttributeDate,
+	AttributeNote,
+	AttributeTOTP,
+	AttributeFile,
+	AttributePEM,
+}
+
+func IsValidAttributeType(t string) bool {
+	return StringArrayContains(AttributeTypes, t)
+}
+
+// GetType returns the type of the attribute. Attributes created before types
+// were introduced have their type inferred from their flags.
+func (a *Attribute) GetType() string {
+	if a.Type != "" {
+		return a.Type
+	}
+	if a.File {
+		return AttributeFile
+	}
+	if a.EyesOnly {
+		return AttributePassword
+	}
+	return AttributeText
+}
+
+// IsFileType tells whether values of this type are stored base64-encoded.
+func IsFileType(t string) bool {
+	return t == AttributeFile || t == AttributePEM
+}
+
+// IsSecretType tells whether values of this type are always eyes-only.
+func IsSecretType(t string) bool {
+	return t == AttributePassword || t == AttributeTOTP
+}
+
+// NormalizeAttribute aligns the flags of an attribute with its type and
+// validates its value.
+func NormalizeAttribute(a *Attribute) error {
+	t := a.GetType()
+
+	if IsSecretType(t) {
+		a.EyesOnly = true
+	}
+	if a.Reference != "" {
+		// The value lives in the referenced attribute
+		return nil
+	}
+	if IsFileType(t) && !a.File {
+		return fmt.Errorf("%s attributes must be read from a file", t)
+	}
+	if a.File && !IsFileType(t) {
+		return fmt.Errorf("file content cannot be stored in a %s attribute", t)
+	}
+	if a.Type == AttributeText && !a.EyesOnly && !a.File {
+		// Plain text is the default, no need to store it
+		a.Type = ""
+	}
+
+	return ValidateAttributeValue(t, a.Value)
+}
+
+func ValidateAttributeValue(t, value string) error {
+	switch t {
+	case AttributeURL:
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("'%s' is not an absolute URL", value)
+		}
+	case AttributeEmail:
+		if _, err := mail.ParseAddress(value); err != nil {
+			return fmt.Errorf("'%s' is not an email address", value)
+		}
+	case AttributeDate:
+		if _, err := time.Parse(DateFormat, value); err != nil {
+			return fmt.Errorf("'%s' is not a date formatted as YYYY-MM-DD", value)
+		}
+	case AttributeTOTP:
+		if strings.HasPrefix(value, "otpauth://") {
+			return nil
+		}
+		seed := strings.ToUpper(strings.Replace(value, " ", "", -1))
+		if _, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(seed, "=")); err != nil {
+			return errors.New("TOTP attributes must be an otpauth:// URI or a base32 seed")
+		}
+	case AttributePEM:
+		content, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return err
+		}
+		if block, _ := pem.Decode(content); block == nil {
+			return errors.New("file does not contain any PEM block")
+		}
+	}
+
+	return nil
+}
+
+// PEMBlockTypes lists the types of the PEM blocks stored in a pem attribute.
+func PEMBlockTypes(value string) []string {
+	content, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil
+	}
+
+	types := make([]string, 0)
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			break
+		}
+		types = append(types, block.Type)
+	}
+
+	return types
+}
@@ -0,0 +1,55 @@
+package util
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testCertificate = `-----BEGIN CERTIFICATE-----
+MIIBhTCCASugAwIBAgIQIRi6zePL6mKjOipn+dNuaTAKBggqhkjOPQQDAjASMRAw
+-----END CERTIFICATE-----
+`
+
+func TestAttributeTypeInference(t *testing.T) {
+	assert.Equal(t, AttributeText, (&Attribute{Value: "apognu"}).GetType())
+	assert.Equal(t, AttributePassword, (&Attribute{Value: "secret", EyesOnly: true}).GetType())
+	assert.Equal(t, AttributeFile, (&Attribute{Value: "Zm9v", File: true}).GetType())
+	assert.Equal(t, AttributeURL, (&Attribute{Value: "http://example.com", Type: AttributeURL}).GetType())
+}
+
+func TestNormalizeAttribute(t *testing.T) {
+	password := &Attribute{Value: "secret", Type: AttributePassword}
+	assert.Nil(t, NormalizeAttribute(password))
+	assert.True(t, password.EyesOnly, "password attributes should be eyes-only")
+
+	text := &Attribute{Value: "apognu", Type: AttributeText}
+	assert.Nil(t, NormalizeAttribute(text))
+	assert.Equal(t, "", text.Type, "plain text type should not be stored")
+
+	assert.NotNil(t, NormalizeAttribute(&Attribute{Value: "foo", Type: AttributeFile}), "file attributes should come from files")
+	assert.NotNil(t, NormalizeAttribute(&Attribute{Value: "Zm9v", File: true, Type: AttributeURL}))
+}
+
+func TestValidateAttributeValue(t *testing.T) {
+	assert.Nil(t, ValidateAttributeValue(AttributeURL, "https://example.com/login"))
+	assert.NotNil(t, ValidateAttributeValue(AttributeURL, "example.com"))
+
+	assert.Nil(t, ValidateAttributeValue(AttributeEmail, "apognu@example.com"))
+	assert.NotNil(t, ValidateAttributeValue(AttributeEmail, "apognu"))
+
+	assert.Nil(t, ValidateAttributeValue(AttributeDate, "2018-01-31"))
+	assert.NotNil(t, ValidateAttributeValue(AttributeDate, "31/01/2018"))
+
+	assert.Nil(t, ValidateAttributeValue(AttributeTOTP, "JBSWY3DPEHPK3PXP"))
+	assert.Nil(t, ValidateAttributeValue(AttributeTOTP, "otpauth://totp/Example?secret=JBSWY3DPEHPK3PXP"))
+	assert.NotNil(t, ValidateAttributeValue(AttributeTOTP, "not a seed!"))
+
+	pem := base64.StdEncoding.EncodeToString([]byte(testCertificate))
+	assert.Nil(t, ValidateAttributeValue(AttributePEM, pem))
+	assert.Equal(t, []string{"CERTIFICATE"}, PEMBlockTypes(pem))
+	assert.NotNil(t, ValidateAttributeValue(AttributePEM, base64.StdEncoding.EncodeToString([]byte("garbage"))))
+
+	assert.Nil(t, ValidateAttributeValue(AttributeText, "anything goes"))
+}
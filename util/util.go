@@ -3,20 +3,8 @@ package util
 import (
 	"os"
 	"path/filepath"
-	"regexp"
-	"strings"
 )
 
-func IsValidPath(path string) bool {
-	rgx := regexp.MustCompile("^[a-z0-9-]+$")
-	for _, t := range strings.Split(path, string(os.PathSeparator)) {
-		if !rgx.Match([]byte(t)) {
-			return false
-		}
-	}
-	return true
-}
-
 func StringArrayContains(arr []string, item string) bool {
 	for _, v := range arr {
 		if v == item {
@@ -36,14 +24,27 @@ func RemoveFromSlice(arr []string, item string) []string {
 	return newArr
 }
 
+// vaultFiles are the entries at the root of the vault that do not hold
+// secrets, besides the .git directory.
+var vaultFiles = []string{"_vault.meta", "_vault.meta.new", "_vault.templates"}
+
+// ShouldFileBeWalked tells whether a file met while walking the vault holds a
+// secret. The error is filepath.SkipDir for the .git directory.
 func ShouldFileBeWalked(path string) (bool, error) {
-	if strings.HasSuffix(path, ".git") {
-		return false, filepath.SkipDir
+	rel, err := filepath.Rel(GetVaultPath(), path)
+	if err != nil {
+		return false, nil
 	}
-	if strings.HasSuffix(path, "_vault.meta") || strings.HasSuffix(path, "_vault.meta.new") {
+	rel = filepath.ToSlash(rel)
+
+	info, err := os.Stat(path)
+	if err != nil {
 		return false, nil
 	}
-	if f, _ := os.Stat(path); f.IsDir() {
+	if rel == ".git" && info.IsDir() {
+		return false, filepath.SkipDir
+	}
+	if StringArrayContains(vaultFiles, rel) || info.IsDir() {
 		return false, nil
 	}
 	return true, nil
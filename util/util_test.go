@@ -1,6 +1,8 @@
 package util
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -20,3 +22,24 @@ func TestRemoveFromSlice(t *testing.T) {
 	assert.Equal(t, 4, len(newArr), "array should contain one less element")
 	assert.False(t, StringArrayContains(newArr, "ipsum"))
 }
+
+func TestListSecretPaths(t *testing.T) {
+	defer withConfigDir(t)()
+
+	dir, err := ioutil.TempDir("", "vault-walk")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	vaultDir = dir
+	vaultSelected = true
+
+	// Vault files only match at the root, and only as a whole
+	assert.Nil(t, os.MkdirAll(dir+"/.git/objects", 0700))
+	assert.Nil(t, os.MkdirAll(dir+"/work", 0700))
+	for _, name := range []string{".git/config", ".git/objects/ab", "_vault.meta", "_vault.meta.new", "_vault.templates", "a", "repo.git", "z", "my_vault.meta", "work/site.git"} {
+		assert.Nil(t, ioutil.WriteFile(dir+"/"+name, []byte(`{}`), 0600))
+	}
+
+	secrets, err := ListSecretPaths("/")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "my_vault.meta", "repo.git", "work/site.git", "z"}, secrets)
+}
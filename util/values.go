@@ -0,0 +1,174 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"unicode/utf16"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// SecretAlloc, when set, returns memory with room for size bytes in which
+// attribute values are decoded, instead of the Go heap. crypt sets it while
+// decoding decrypted secrets, so their values stay in locked memory. The
+// returned slice must not be reused, since the decoded strings point into it.
+var SecretAlloc func(size int) []byte
+
+// secretValue is an attribute value decoded through SecretAlloc.
+type secretValue string
+
+func (v *secretValue) UnmarshalJSON(data []byte) error {
+	if SecretAlloc == nil || len(data) == 0 || data[0] != '"' {
+		var value string
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+		*v = secretValue(value)
+		return nil
+	}
+
+	// An unescaped string is never longer than its JSON encoding
+	value, err := unquoteJSON(SecretAlloc(len(data))[:0], data)
+	if err != nil {
+		return err
+	}
+	if len(value) > 0 {
+		*v = secretValue(*(*string)(unsafe.Pointer(&value)))
+	} else {
+		*v = ""
+	}
+
+	return nil
+}
+
+func (a *Attribute) UnmarshalJSON(data []byte) error {
+	type plain Attribute
+	value := struct {
+		*plain
+		Value secretValue `json:"value"`
+	}{plain: (*plain)(a)}
+
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	a.Value = string(value.Value)
+
+	return nil
+}
+
+func (h *AttributeHistory) UnmarshalJSON(data []byte) error {
+	type plain AttributeHistory
+	value := struct {
+		*plain
+		Value secretValue `json:"value"`
+	}{plain: (*plain)(h)}
+
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	h.Value = string(value.Value)
+
+	return nil
+}
+
+func (p *PendingValue) UnmarshalJSON(data []byte) error {
+	type plain PendingValue
+	value := struct {
+		*plain
+		Value secretValue `json:"value"`
+	}{plain: (*plain)(p)}
+
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	p.Value = string(value.Value)
+
+	return nil
+}
+
+// unquoteJSON appends the content of a JSON string literal to dst, which
+// must have enough capacity to hold it so that it is never copied elsewhere.
+func unquoteJSON(dst, data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != '"' || data[len(data)-1] != '"' {
+		return nil, errors.New("invalid JSON string")
+	}
+	data = data[1 : len(data)-1]
+
+	var encoded [utf8.UTFMax]byte
+	for i := 0; i < len(data); i++ {
+		if data[i] != '\\' {
+			dst = append(dst, data[i])
+			continue
+		}
+
+		i++
+		if i >= len(data) {
+			return nil, errors.New("invalid escape sequence in JSON string")
+		}
+
+		switch data[i] {
+		case '"', '\\', '/':
+			dst = append(dst, data[i])
+		case 'b':
+			dst = append(dst, '\b')
+		case 'f':
+			dst = append(dst, '\f')
+		case 'n':
+			dst = append(dst, '\n')
+		case 'r':
+			dst = append(dst, '\r')
+		case 't':
+			dst = append(dst, '\t')
+		case 'u':
+			r, ok := readHexRune(data[i+1:])
+			if !ok {
+				return nil, errors.New("invalid unicode escape in JSON string")
+			}
+			i += 4
+
+			// Characters outside of the BMP are escaped as surrogate pairs
+			if utf16.IsSurrogate(r) {
+				high := r
+				r = utf8.RuneError
+				if i+2 < len(data) && data[i+1] == '\\' && data[i+2] == 'u' {
+					if low, ok := readHexRune(data[i+3:]); ok {
+						if pair := utf16.DecodeRune(high, low); pair != utf8.RuneError {
+							r = pair
+							i += 6
+						}
+					}
+				}
+			}
+
+			n := utf8.EncodeRune(encoded[:], r)
+			dst = append(dst, encoded[:n]...)
+		default:
+			return nil, errors.New("invalid escape sequence in JSON string")
+		}
+	}
+
+	return dst, nil
+}
+
+// readHexRune reads the four hexadecimal digits of a unicode escape.
+func readHexRune(data []byte) (rune, bool) {
+	if len(data) < 4 {
+		return 0, false
+	}
+
+	var r rune
+	for _, c := range data[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			r = r<<4 | rune(c-'0')
+		case c >= 'a' && c <= 'f':
+			r = r<<4 | rune(c-'a'+10)
+		case c >= 'A' && c <= 'F':
+			r = r<<4 | rune(c-'A'+10)
+		default:
+			return 0, false
+		}
+	}
+
+	return r, true
+}
@@ -0,0 +1,67 @@
+package util
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnquoteJSON(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"Sup3rS3cre7",
+		"quote \" backslash \\ slash /",
+		"\b\f\n\r\t\x01",
+		"héllo wörld 日本",
+		"emoji 😀 outside of the BMP",
+		"<html> & co",
+	} {
+		data, err := json.Marshal(value)
+		assert.Nil(t, err)
+
+		dst := make([]byte, 0, len(data))
+		out, err := unquoteJSON(dst, data)
+		assert.Nil(t, err)
+		assert.Equal(t, value, string(out))
+	}
+
+	// Escapes that encoding/json never produces, and lone surrogates
+	for data, value := range map[string]string{
+		`"\/\u00e9"`:       "/\u00e9",
+		`"\ud83d\ude00"`:   "\U0001f600",
+		`"\ud83d"`:         "\ufffd",
+		`"\ud83d\u0041"`:   "\ufffdA",
+		`"\ude00 trailer"`: "\ufffd trailer",
+	} {
+		out, err := unquoteJSON(make([]byte, 0, len(data)), []byte(data))
+		assert.Nil(t, err)
+		assert.Equal(t, value, string(out), data)
+
+		var expected string
+		assert.Nil(t, json.Unmarshal([]byte(data), &expected))
+		assert.Equal(t, expected, string(out), data)
+	}
+
+	for _, data := range []string{`"\x"`, `"\u12"`, `"\u12zz"`, `"trailing\"`, `unquoted`, `"`} {
+		_, err := unquoteJSON(nil, []byte(data))
+		assert.NotNil(t, err, data)
+	}
+}
+
+func TestSecretAlloc(t *testing.T) {
+	arena := make([]byte, 64)
+	used := 0
+	SecretAlloc = func(size int) []byte {
+		b := arena[used : used+size]
+		used += size
+		return b
+	}
+	defer func() { SecretAlloc = nil }()
+
+	var attr Attribute
+	assert.Nil(t, json.Unmarshal([]byte(`{"value":"päss","eyesonly":true}`), &attr))
+	assert.Equal(t, "päss", attr.Value)
+	assert.True(t, attr.EyesOnly)
+	assert.Equal(t, "päss", string(arena[:len(attr.Value)]), "value should be decoded into the allocated memory")
+}
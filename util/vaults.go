@@ -0,0 +1,206 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// VaultRegistry maps vault names to the directory they are stored in.
+type VaultRegistry struct {
+	Default string            `json:"default"`
+	Vaults  map[string]string `json:"vaults"`
+}
+
+var vaultNameRegex = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+func GetConfigDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "vault")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".config", "vault")
+}
+
+func getVaultRegistryPath() string {
+	return filepath.Join(GetConfigDir(), "vaults.json")
+}
+
+func LoadVaultRegistry() (*VaultRegistry, error) {
+	registry := &VaultRegistry{Vaults: make(map[string]string)}
+
+	registryJson, err := ioutil.ReadFile(getVaultRegistryPath())
+	if os.IsNotExist(err) {
+		return registry, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(registryJson, registry); err != nil {
+		return nil, err
+	}
+	if registry.Vaults == nil {
+		registry.Vaults = make(map[string]string)
+	}
+
+	return registry, nil
+}
+
+func (r *VaultRegistry) Save() error {
+	if err := os.MkdirAll(GetConfigDir(), 0700); err != nil {
+		return err
+	}
+
+	registryJson, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(getVaultRegistryPath(), registryJson, 0600)
+}
+
+func (r *VaultRegistry) Add(name, path string) error {
+	if !vaultNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid vault name: %s", name)
+	}
+	if _, ok := r.Vaults[name]; ok {
+		return fmt.Errorf("vault '%s' already exists", name)
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	r.Vaults[name] = absPath
+	if len(r.Vaults) == 1 {
+		r.Default = name
+	}
+
+	return nil
+}
+
+func (r *VaultRegistry) Remove(name string) error {
+	if _, ok := r.Vaults[name]; !ok {
+		return fmt.Errorf("unknown vault '%s'", name)
+	}
+
+	delete(r.Vaults, name)
+	if r.Default == name {
+		r.Default = ""
+	}
+
+	return nil
+}
+
+func (r *VaultRegistry) SetDefault(name string) error {
+	if _, ok := r.Vaults[name]; !ok {
+		return fmt.Errorf("unknown vault '%s'", name)
+	}
+
+	r.Default = name
+
+	return nil
+}
+
+func (r *VaultRegistry) Names() []string {
+	names := make([]string, 0, len(r.Vaults))
+	for name := range r.Vaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// SelectVault chooses the vault every command operates on. An explicit name
+// takes precedence over VAULT_PATH, which takes precedence over the default
+// registered vault.
+func SelectVault(name string) error {
+	registry, err := LoadVaultRegistry()
+	if err != nil {
+		return fmt.Errorf("could not read vault registry: %s", err)
+	}
+
+	if name == "" {
+		if os.Getenv("VAULT_PATH") != "" || registry.Default == "" {
+			return nil
+		}
+		name = registry.Default
+	}
+
+	path, ok := registry.Vaults[name]
+	if !ok {
+		return fmt.Errorf("unknown vault '%s'", name)
+	}
+
+	vaultDir = path
+	vaultName = name
+	vaultSelected = true
+
+	return nil
+}
+
+func GetVaultName() string {
+	return vaultName
+}
+
+func ListVaults() {
+	registry, err := LoadVaultRegistry()
+	if err != nil {
+		logrus.Fatalf("could not read vault registry: %s", err)
+	}
+
+	FormatVaultList(registry)
+}
+
+func AddVault(name, path string) {
+	registry, err := LoadVaultRegistry()
+	if err != nil {
+		logrus.Fatalf("could not read vault registry: %s", err)
+	}
+	if err := registry.Add(name, path); err != nil {
+		logrus.Fatalf("could not add vault: %s", err)
+	}
+	if err := registry.Save(); err != nil {
+		logrus.Fatalf("could not write vault registry: %s", err)
+	}
+
+	logrus.Infof("vault '%s' was successfully added", name)
+}
+
+func RemoveVault(name string) {
+	registry, err := LoadVaultRegistry()
+	if err != nil {
+		logrus.Fatalf("could not read vault registry: %s", err)
+	}
+	if err := registry.Remove(name); err != nil {
+		logrus.Fatalf("could not remove vault: %s", err)
+	}
+	if err := registry.Save(); err != nil {
+		logrus.Fatalf("could not write vault registry: %s", err)
+	}
+
+	logrus.Infof("vault '%s' was successfully removed, its content was left untouched", name)
+}
+
+func SetDefaultVault(name string) {
+	registry, err := LoadVaultRegistry()
+	if err != nil {
+		logrus.Fatalf("could not read vault registry: %s", err)
+	}
+	if err := registry.SetDefault(name); err != nil {
+		logrus.Fatalf("could not set default vault: %s", err)
+	}
+	if err := registry.Save(); err != nil {
+		logrus.Fatalf("could not write vault registry: %s", err)
+	}
+
+	logrus.Infof("vault '%s' is now the default vault", name)
+}
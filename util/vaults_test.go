@@ -0,0 +1,75 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withConfigDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "vault-config")
+	assert.Nil(t, err)
+
+	oldConfig := os.Getenv("XDG_CONFIG_HOME")
+	oldPath := os.Getenv("VAULT_PATH")
+	oldDir := vaultDir
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	os.Unsetenv("VAULT_PATH")
+
+	return func() {
+		os.Setenv("XDG_CONFIG_HOME", oldConfig)
+		os.Setenv("VAULT_PATH", oldPath)
+		os.RemoveAll(dir)
+		vaultDir = oldDir
+		vaultName = ""
+		vaultSelected = false
+		config = make(map[string]interface{})
+	}
+}
+
+func TestVaultRegistry(t *testing.T) {
+	defer withConfigDir(t)()
+
+	registry, err := LoadVaultRegistry()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(registry.Vaults), "registry should be empty when not created yet")
+
+	assert.Nil(t, registry.Add("personal", "/tmp/personal"))
+	assert.Nil(t, registry.Add("team", "/tmp/team"))
+	assert.NotNil(t, registry.Add("team", "/tmp/other"), "vault names should be unique")
+	assert.NotNil(t, registry.Add("bad name", "/tmp/other"), "vault names should be validated")
+	assert.Equal(t, "personal", registry.Default, "first vault should become the default")
+
+	assert.Nil(t, registry.SetDefault("team"))
+	assert.NotNil(t, registry.SetDefault("unknown"))
+	assert.Nil(t, registry.Save())
+
+	registry, err = LoadVaultRegistry()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"personal", "team"}, registry.Names())
+	assert.Equal(t, "team", registry.Default)
+
+	assert.Nil(t, registry.Remove("team"))
+	assert.NotNil(t, registry.Remove("team"))
+	assert.Equal(t, "", registry.Default, "removing the default vault should unset the default")
+}
+
+func TestSelectVault(t *testing.T) {
+	defer withConfigDir(t)()
+
+	registry, _ := LoadVaultRegistry()
+	registry.Add("personal", "/tmp/personal")
+	registry.Add("team", "/tmp/team")
+	assert.Nil(t, registry.Save())
+
+	assert.Nil(t, SelectVault(""))
+	assert.Equal(t, "/tmp/personal", GetVaultPath(), "default vault should be selected")
+
+	assert.Nil(t, SelectVault("team"))
+	assert.Equal(t, "/tmp/team", GetVaultPath())
+	assert.Equal(t, "team", GetVaultName())
+
+	assert.NotNil(t, SelectVault("unknown"))
+}
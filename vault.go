@@ -3,6 +3,7 @@ package main
 import (
 	"os"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/apognu/vault/crypt"
 	"github.com/apognu/vault/util"
 
@@ -10,16 +11,41 @@ import (
 )
 
 func main() {
+	// Keep key material out of core dumps and wipe it whenever we exit
+	crypt.HardenProcess()
+	logrus.RegisterExitHandler(crypt.DestroySecureBuffers)
+	defer crypt.DestroySecureBuffers()
+
 	app := kingpin.New("vault", "Simple encrypted data store")
 	app.HelpFlag.Short('h')
 	app.UsageTemplate(kingpin.SeparateOptionalFlagsUsageTemplate)
 
+	appPassphraseFD := app.Flag("passphrase-fd", "read passphrases from this file descriptor, one per line").Default("-1").Int()
+	appPassphraseFile := app.Flag("passphrase-file", "read passphrases from this file, one per line").String()
+	appPassphraseEnv := app.Flag("passphrase-env", "read the passphrase from the VAULT_PASSPHRASE environment variable").Bool()
+	appPinentry := app.Flag("pinentry-program", "pinentry program used to prompt for secrets without a terminal").Envar("VAULT_PINENTRY_PROGRAM").String()
+	appVault := app.Flag("vault", "name of the registered vault to use").Envar("VAULT_NAME").String()
+	appColor := app.Flag("color", "colorize output (auto, always or never)").Enum("auto", "always", "never")
+	appAutoPushSet := false
+	appAutoPush := app.Flag("auto-push", "push to the remote repository after every change").Action(flagSet(&appAutoPushSet)).Bool()
+	appAskpass := app.Flag("askpass", "askpass program used to prompt for secrets without a terminal").Envar("VAULT_ASKPASS").String()
+
 	appServer := app.Command("server", "run the HTTP interface")
 	appServerListen := appServer.Flag("listen", "address on which to listen on").Short('l').Default("127.0.0.1:8080").TCP()
 	appServerAPIKey := appServer.Flag("apikey", "API key to use for all requests").Short('k').Required().String()
 
 	appInit := app.Command("init", "initiate the vault")
 
+	appVaults := app.Command("vaults", "registered vaults management")
+	appVaultsList := appVaults.Command("list", "list all registered vaults")
+	appVaultsAdd := appVaults.Command("add", "register a vault under a name")
+	appVaultsAddName := appVaultsAdd.Arg("name", "name of the vault").Required().String()
+	appVaultsAddPath := appVaultsAdd.Arg("path", "directory of the vault").Required().String()
+	appVaultsRemove := appVaults.Command("remove", "unregister a vault, leaving its content untouched")
+	appVaultsRemoveName := appVaultsRemove.Arg("name", "name of the vault").Required().String()
+	appVaultsDefault := appVaults.Command("default", "set the vault used when none is specified")
+	appVaultsDefaultName := appVaultsDefault.Arg("name", "name of the vault").Required().String()
+
 	appKey := app.Command("key", "vault key management")
 	appKeyList := appKey.Command("list", "list all keys available in the vault")
 	appKeyAdd := appKey.Command("add", "add a key that unlocks the vault")
@@ -30,6 +56,8 @@ func main() {
 
 	appList := app.Command("list", "list all secrets")
 	appListPath := appList.Arg("path", "secret path").Default("/").String()
+	appListTags := appList.Flag("tag", "only list secrets with this tag").Short('t').Strings()
+	appListOutput := appList.Flag("output", "output format (text, json or paths)").Short('o').Default(util.OutputText).Enum(util.ListOutputs...)
 
 	appShow := app.Command("show", "show all secrets")
 	appShowPath := appShow.Arg("path", "secret path").Required().String()
@@ -39,19 +67,93 @@ func main() {
 	appShowWrite := appShow.Flag("write", "write file attributes on the filesystem").Short('w').Bool()
 	appShowWriteFiles := appShow.Flag("file", "which file attributes to write").Short('f').Strings()
 	appShowWriteStdout := appShow.Flag("stdout", "print file attribute to STDOUT").Short('s').Bool()
+	appShowHistory := appShow.Flag("history", "list the previous values of an attribute").String()
+	appShowAuthorizedKeys := appShow.Flag("authorized-keys", "print the SSH public keys of the secret as authorized_keys lines").Bool()
+	appShowOutput := appShow.Flag("output", "output format (text, json, yaml, env or dotenv)").Short('o').Default(util.OutputText).Enum(util.SecretOutputs...)
+
+	appGet := app.Command("get", "print the raw value of an attribute, for scripts")
+	appGetPath := appGet.Arg("path", "secret path").Required().String()
+	appGetAttr := appGet.Arg("attribute", "attribute to print").Required().String()
+
+	appOTP := app.Command("otp", "print a one-time password from a TOTP or HOTP attribute")
+	appOTPPath := appOTP.Arg("path", "secret path").Required().String()
+	appOTPAttr := appOTP.Arg("attribute", "attribute holding the OTP seed").String()
+	appOTPClipboard := appOTP.Flag("clip", "copy the one-time password into clipboard").Short('c').Bool()
 
 	appAdd := app.Command("add", "add a secret")
 	appAddPath := appAdd.Arg("path", "secret path").Required().String()
-	appAddAttrs := appAdd.Arg("attributes", "secret attributes").Required().StringMap()
-	appAddGeneratorLength := appAdd.Flag("length", "length of generated passwords").Short('l').Default("16").Int()
-	appAddGeneratorSymbols := appAdd.Flag("symbols", "include special characters in the generated password").Default("false").Bool()
+	appAddAttrs := appAdd.Arg("attributes", "secret attributes").Strings()
+	appAddTemplate := appAdd.Flag("template", "template the secret follows").String()
+	appAddTags := appAdd.Flag("tag", "tags of the secret").Short('t').Strings()
+	appAddNote := appAdd.Flag("note", "free-text description of the secret").Short('n').String()
+	appAddExpires := appAdd.Flag("expires", "expiration date of the secret, as YYYY-MM-DD or a duration such as 90d").String()
+	appAddAttrExpires := appAdd.Flag("expires-attr", "expiration dates of attributes, as attr=YYYY-MM-DD or attr=90d").StringMap()
+	appAddGeneratorLength := appAdd.Flag("length", "length of generated passwords").Short('l').Int()
+	appAddGeneratorSymbolsSet := false
+	appAddGeneratorSymbols := appAdd.Flag("symbols", "include special characters in the generated password").Action(flagSet(&appAddGeneratorSymbolsSet)).Bool()
 
 	appEdit := app.Command("edit", "edit an existing secret")
 	appEditPath := appEdit.Arg("path", "path to the secret to edit").Required().String()
 	appEditDeletedAttrs := appEdit.Flag("delete", "attributes to delete from the secret").Short('d').Strings()
-	appEditAttrs := appEdit.Arg("attributes", "secret attributes").StringMap()
-	appEditGeneratorLength := appEdit.Flag("length", "length of generated passwords").Short('l').Default("16").Int()
-	appEditGeneratorSymbols := appEdit.Flag("symbols", "include special characters in the generated password").Default("false").Bool()
+	appEditAttrs := appEdit.Arg("attributes", "secret attributes").Strings()
+	appEditOrder := appEdit.Flag("order", "attributes to move first, in this order").Short('o').Strings()
+	appEditRenamedAttrs := appEdit.Flag("rename", "attributes to rename, as old=new").Short('r').StringMap()
+	appEditHiddenAttrs := appEdit.Flag("hide", "attributes to make eyes-only").Strings()
+	appEditRevealedAttrs := appEdit.Flag("reveal", "attributes to make visible").Strings()
+	appEditRevertedAttrs := appEdit.Flag("revert", "attributes to restore to a previous value, as attr or attr@N").Strings()
+	appEditTags := appEdit.Flag("tag", "tags to add to the secret").Short('t').Strings()
+	appEditUntags := appEdit.Flag("untag", "tags to remove from the secret").Strings()
+	appEditNoteSet := false
+	appEditNote := appEdit.Flag("note", "free-text description of the secret, empty to remove it").Short('n').Action(flagSet(&appEditNoteSet)).String()
+	appEditExpiresSet := false
+	appEditExpires := appEdit.Flag("expires", "expiration date of the secret, as YYYY-MM-DD or a duration such as 90d, empty to remove it").Action(flagSet(&appEditExpiresSet)).String()
+	appEditAttrExpires := appEdit.Flag("expires-attr", "expiration dates of attributes, as attr=YYYY-MM-DD or attr=90d, empty to remove them").StringMap()
+	appEditGeneratorLength := appEdit.Flag("length", "length of generated passwords").Short('l').Int()
+	appEditGeneratorSymbolsSet := false
+	appEditGeneratorSymbols := appEdit.Flag("symbols", "include special characters in the generated password").Action(flagSet(&appEditGeneratorSymbolsSet)).Bool()
+	appEditEditor := appEdit.Flag("editor", "edit the secret as a YAML document in $EDITOR").Short('e').Bool()
+
+	appGen := app.Command("gen", "generate key material inside the vault")
+	appGenSSH := appGen.Command("ssh", "generate an SSH key pair into the privkey and pubkey attributes of a secret")
+	appGenSSHPath := appGenSSH.Arg("path", "secret path").Required().String()
+	appGenSSHType := appGenSSH.Flag("type", "type of the key (ed25519 or rsa)").Short('t').Default(util.SSHKeyEd25519).Enum(util.SSHKeyTypes...)
+	appGenSSHBits := appGenSSH.Flag("bits", "size of RSA keys").Short('b').Default("4096").Int()
+	appGenSSHComment := appGenSSH.Flag("comment", "comment of the public key").Short('C').String()
+
+	appGenerate := app.Command("generate", "print a random value without storing it, or list the generators")
+	appGenerateKind := appGenerate.Arg("kind", "kind of value to generate").String()
+	appGenerateLength := appGenerate.Flag("length", "length of the generated value, in the unit of its kind").Short('l').Int()
+	appGenerateSymbolsSet := false
+	appGenerateSymbols := appGenerate.Flag("symbols", "include special characters in generated passwords").Action(flagSet(&appGenerateSymbolsSet)).Bool()
+
+	appChange := app.Command("change", "stage a new value for an attribute, kept alongside the current one until confirmed")
+	appChangePath := appChange.Arg("path", "secret path").Required().String()
+	appChangeAttr := appChange.Arg("attribute", "attribute to change").String()
+	appChangeGenerator := appChange.Flag("generator", "kind of value to generate, as kind or kind:length").Short('g').String()
+	appChangePrompt := appChange.Flag("prompt", "type the new value instead of generating it").Bool()
+	appChangeConfirm := appChange.Flag("confirm", "replace the current value with the pending one").Bool()
+	appChangeAbort := appChange.Flag("abort", "discard the pending value").Bool()
+	appChangeGeneratorLength := appChange.Flag("length", "length of generated passwords").Short('l').Int()
+	appChangeGeneratorSymbolsSet := false
+	appChangeGeneratorSymbols := appChange.Flag("symbols", "include special characters in the generated password").Action(flagSet(&appChangeGeneratorSymbolsSet)).Bool()
+
+	appRegen := app.Command("regen", "generate new values for generated attributes, the way they were first generated")
+	appRegenPath := appRegen.Arg("path", "secret path, or directory with --all-older-than").String()
+	appRegenAttrs := appRegen.Arg("attributes", "attributes to regenerate, all generated attributes by default").Strings()
+	appRegenOlderThan := appRegen.Flag("all-older-than", "regenerate the attributes of all secrets generated longer ago than this, such as 90d").String()
+	appRegenDryRun := appRegen.Flag("dry-run", "only list the attributes that would be regenerated").Short('n').Bool()
+
+	appExpiring := app.Command("expiring", "list secrets and attributes close to their expiration date")
+	appExpiringWithin := appExpiring.Flag("within", "how far ahead to look, such as 30d").Short('w').String()
+	appExpiringOutput := appExpiring.Flag("output", "output format (text or json)").Short('o').Default(util.OutputText).Enum(util.ReportOutputs...)
+
+	appCerts := app.Command("certs", "list the X.509 certificates of the vault, soonest expiring first")
+	appCertsOutput := appCerts.Flag("output", "output format (text or json)").Short('o').Default(util.OutputText).Enum(util.ReportOutputs...)
+
+	appRefs := app.Command("refs", "list the attributes referencing a secret")
+	appRefsPath := appRefs.Arg("path", "secret path").Required().String()
+
+	appTemplates := app.Command("templates", "list the available secret templates")
 
 	appRename := app.Command("rename", "rename a secret")
 	appRenamePath := appRename.Arg("path", "path to the secret to rename").Required().String()
@@ -59,6 +161,12 @@ func main() {
 
 	appDelete := app.Command("delete", "delete a secret")
 	appDeletePath := appDelete.Arg("path", "secret path").Required().String()
+	appDeleteRemoveAliases := appDelete.Flag("remove-aliases", "also delete the aliases of the secret").Bool()
+	appDeleteRetargetAliases := appDelete.Flag("retarget-aliases", "point the aliases of the secret to this one").String()
+
+	appAlias := app.Command("alias", "make a secret reachable under another path")
+	appAliasPath := appAlias.Arg("path", "path of the alias").Required().String()
+	appAliasTarget := appAlias.Arg("target", "path of the secret").Required().String()
 
 	appGit := app.Command("git", "archive the store in a git repository")
 	appGitClone := appGit.Command("clone", "clone an existing store repository")
@@ -68,11 +176,106 @@ func main() {
 	appGitPush := appGit.Command("push", "push the state of the store")
 	appGitPull := appGit.Command("pull", "pull the state of the store")
 
-	appUnseal := app.Command("unseal", "unseal store until next reboot")
+	appUnseal := app.Command("unseal", "unseal store until next reboot or timeout")
+	appUnsealTimeout := appUnseal.Flag("timeout", "seal the store again after this duration (e.g. 30m, 8h)").Short('t').String()
 	appSeal := app.Command("seal", "seal store")
 
+	appConfig := app.Command("config", "user configuration management")
+	appConfigList := appConfig.Command("list", "list all settings and their effective values")
+	appConfigGet := appConfig.Command("get", "print the effective value of a setting")
+	appConfigGetKey := appConfigGet.Arg("key", "setting name").Required().String()
+	appConfigSet := appConfig.Command("set", "change the value of a setting")
+	appConfigSetKey := appConfigSet.Arg("key", "setting name").Required().String()
+	appConfigSetValue := appConfigSet.Arg("value", "setting value").Required().String()
+	appConfigSetVault := appConfigSet.Flag("vault-only", "only change the setting for the current vault").Bool()
+
 	args := kingpin.MustParse(app.Parse(os.Args[1:]))
 
+	err := crypt.SetPassphraseSource(crypt.PassphraseSource{
+		FD:       *appPassphraseFD,
+		File:     *appPassphraseFile,
+		Env:      *appPassphraseEnv,
+		Pinentry: *appPinentry,
+		Askpass:  *appAskpass,
+	})
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	switch args {
+	case appVaultsList.FullCommand():
+		util.ListVaults()
+		return
+	case appVaultsAdd.FullCommand():
+		util.AddVault(*appVaultsAddName, *appVaultsAddPath)
+		return
+	case appVaultsRemove.FullCommand():
+		util.RemoveVault(*appVaultsRemoveName)
+		return
+	case appVaultsDefault.FullCommand():
+		util.SetDefaultVault(*appVaultsDefaultName)
+		return
+	}
+
+	if err := util.SelectVault(*appVault); err != nil {
+		logrus.Fatal(err)
+	}
+	if err := util.LoadConfig(); err != nil {
+		logrus.Fatalf("could not read configuration: %s", err)
+	}
+
+	// Command-line flags take precedence over the configuration file
+	if *appColor != "" {
+		util.OverrideConfig("output.color", *appColor)
+	}
+	if appAutoPushSet {
+		util.OverrideConfig("git.autopush", *appAutoPush)
+	}
+	if *appUnsealTimeout != "" {
+		if _, err := util.ParseConfigValue("seal.timeout", *appUnsealTimeout); err != nil {
+			logrus.Fatal(err)
+		}
+		util.OverrideConfig("seal.timeout", *appUnsealTimeout)
+	}
+	if *appAddGeneratorLength == 0 {
+		*appAddGeneratorLength = util.ConfigInt("generator.length")
+	}
+	if *appEditGeneratorLength == 0 {
+		*appEditGeneratorLength = util.ConfigInt("generator.length")
+	}
+	if *appChangeGeneratorLength == 0 {
+		*appChangeGeneratorLength = util.ConfigInt("generator.length")
+	}
+	if !appAddGeneratorSymbolsSet {
+		*appAddGeneratorSymbols = util.ConfigBool("generator.symbols")
+	}
+	if !appEditGeneratorSymbolsSet {
+		*appEditGeneratorSymbols = util.ConfigBool("generator.symbols")
+	}
+	if !appChangeGeneratorSymbolsSet {
+		*appChangeGeneratorSymbols = util.ConfigBool("generator.symbols")
+	}
+	if !appGenerateSymbolsSet {
+		*appGenerateSymbols = util.ConfigBool("generator.symbols")
+	}
+
+	util.ApplyConfig()
+
+	switch args {
+	case appConfigList.FullCommand():
+		util.ListConfig()
+		return
+	case appConfigGet.FullCommand():
+		util.ShowConfig(*appConfigGetKey)
+		return
+	case appConfigSet.FullCommand():
+		util.SetConfig(*appConfigSetKey, *appConfigSetValue, *appConfigSetVault)
+		return
+	case appGenerate.FullCommand():
+		printGenerated(*appGenerateKind, *appGenerateLength, *appGenerateSymbols)
+		return
+	}
+
 	switch args {
 	case appServer.FullCommand():
 		StartServer(*appServerListen, *appServerAPIKey)
@@ -97,17 +300,68 @@ func main() {
 		crypt.RotateKey()
 
 	case appList.FullCommand():
-		listSecrets(*appListPath)
+		listSecrets(*appListPath, *appListTags, *appListOutput)
 	case appShow.FullCommand():
-		showSecret(*appShowPath, *appShowPrint, *appShowClipboard, *appShowClipAttr, *appShowWrite, *appShowWriteFiles, *appShowWriteStdout)
+		showSecret(*appShowPath, *appShowPrint, *appShowClipboard, *appShowClipAttr, *appShowWrite, *appShowWriteFiles, *appShowWriteStdout, *appShowHistory, *appShowAuthorizedKeys, *appShowOutput)
+	case appGet.FullCommand():
+		getAttribute(*appGetPath, *appGetAttr)
+	case appOTP.FullCommand():
+		otpSecret(*appOTPPath, *appOTPAttr, *appOTPClipboard)
 	case appAdd.FullCommand():
-		addSecret(*appAddPath, *appAddAttrs, *appAddGeneratorLength, *appAddGeneratorSymbols, false, []string{})
+		addSecret(*appAddPath, *appAddAttrs, *appAddTemplate, *appAddTags, *appAddNote, *appAddExpires, *appAddAttrExpires, *appAddGeneratorLength, *appAddGeneratorSymbols, false, []string{})
 	case appEdit.FullCommand():
-		editSecret(*appEditPath, *appEditAttrs, *appEditDeletedAttrs, *appEditGeneratorLength, *appEditGeneratorSymbols)
+		if *appEditEditor {
+			if len(*appEditAttrs) > 0 {
+				logrus.Fatal("attributes cannot be given along with --editor")
+			}
+			editSecretInEditor(*appEditPath)
+			break
+		}
+
+		var note, expires *string
+		if appEditNoteSet {
+			note = appEditNote
+		}
+		if appEditExpiresSet {
+			expires = appEditExpires
+		}
+		editSecret(*appEditPath, *appEditAttrs, *appEditDeletedAttrs, *appEditOrder, *appEditRenamedAttrs, *appEditHiddenAttrs, *appEditRevealedAttrs, *appEditRevertedAttrs, *appEditTags, *appEditUntags, note, expires, *appEditAttrExpires, *appEditGeneratorLength, *appEditGeneratorSymbols)
+	case appGenSSH.FullCommand():
+		generateSSHKey(*appGenSSHPath, *appGenSSHType, *appGenSSHBits, *appGenSSHComment)
+	case appChange.FullCommand():
+		switch {
+		case *appChangeConfirm && *appChangeAbort:
+			logrus.Fatal("--confirm and --abort cannot be given together")
+		case *appChangeConfirm || *appChangeAbort:
+			finishChange(*appChangePath, *appChangeAttr, *appChangeConfirm)
+		default:
+			changeSecret(*appChangePath, *appChangeAttr, *appChangeGenerator, *appChangePrompt, *appChangeGeneratorLength, *appChangeGeneratorSymbols)
+		}
+	case appRegen.FullCommand():
+		switch {
+		case *appRegenOlderThan != "" && len(*appRegenAttrs) > 0:
+			logrus.Fatal("attributes cannot be given with --all-older-than")
+		case *appRegenOlderThan != "":
+			regenerateOlderThan(*appRegenPath, *appRegenOlderThan, *appRegenDryRun)
+		case *appRegenPath == "":
+			logrus.Fatal("a secret path or --all-older-than is required")
+		default:
+			regenerateSecret(*appRegenPath, *appRegenAttrs, *appRegenDryRun)
+		}
+	case appExpiring.FullCommand():
+		expiringSecrets(*appExpiringWithin, *appExpiringOutput)
+	case appCerts.FullCommand():
+		listCertificates(*appCertsOutput)
+	case appRefs.FullCommand():
+		listBackReferences(*appRefsPath)
+	case appTemplates.FullCommand():
+		listTemplates()
 	case appRename.FullCommand():
 		renameSecret(*appRenamePath, *appRenameNewPath)
 	case appDelete.FullCommand():
-		deleteSecret(*appDeletePath)
+		deleteSecret(*appDeletePath, *appDeleteRemoveAliases, *appDeleteRetargetAliases)
+	case appAlias.FullCommand():
+		aliasSecret(*appAliasPath, *appAliasTarget)
 
 	case appGitRemote.FullCommand():
 		util.GitRemote(*appGitRemoteURL)
@@ -122,3 +376,12 @@ func main() {
 		crypt.Seal(false)
 	}
 }
+
+// flagSet returns an action recording that a flag was given on the command
+// line, so that configured defaults do not override it.
+func flagSet(set *bool) kingpin.Action {
+	return func(*kingpin.ParseContext) error {
+		*set = true
+		return nil
+	}
+}